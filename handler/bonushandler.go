@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+)
+
+// BonusPostHandler grant a bonus with a wagering requirement to the e-Wallet
+func (h *AppHandler) BonusPostHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	// init empty bonus grant
+	g := models.BonusGrant{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&g)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	g.ClientID = clientID
+	g.Address = guid
+
+	key := req.Header.Get("Idempotency-Key")
+	if key == "" {
+		key = g.ExternalReference
+	}
+	grant, err := h.db.GrantBonus(&g, key)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: grant}, http.StatusOK)
+}
+
+// BonusGetAllHandler return the bonus grants of the e-Wallet with their wagering progress
+func (h *AppHandler) BonusGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	grants, err := h.db.GetAllBonusGrant(clientID, guid)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &grants}, http.StatusOK)
+}
@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avecost/ewallet/response"
+)
+
+// precedenceRequest is the body of a bucket precedence change
+type precedenceRequest struct {
+	Precedence []string `json:"precedence"`
+}
+
+// WalletBucketsGetHandler return the balance of each bucket of the e-Wallet
+func (h *AppHandler) WalletBucketsGetHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	buckets, err := h.db.GetWalletBuckets(clientID, guid)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: buckets}, http.StatusOK)
+}
+
+// BucketPrecedencePutHandler set the order debits draw from the e-Wallet buckets
+func (h *AppHandler) BucketPrecedencePutHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	p := precedenceRequest{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&p)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	buckets, err := h.db.SetBucketPrecedence(clientID, guid, p.Precedence)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: buckets}, http.StatusOK)
+}
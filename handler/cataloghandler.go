@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+	"github.com/gorilla/mux"
+)
+
+// MethodTypePutHandler create or replace a method type of the client catalog
+func (h *AppHandler) MethodTypePutHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	// init empty method type
+	m := models.MethodType{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&m)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	m.ClientID = clientID
+	m.Code = mux.Vars(req)["code"]
+
+	err = h.db.SetMethodType(&m)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &m}, http.StatusOK)
+}
+
+// MethodTypeGetAllHandler return the method type catalog of the client
+func (h *AppHandler) MethodTypeGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	methods, err := h.db.GetAllMethodType(clientID)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &methods}, http.StatusOK)
+}
+
+// MethodTypeDeleteHandler remove a method type from the client catalog
+func (h *AppHandler) MethodTypeDeleteHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	err := h.db.DeleteMethodType(clientID, mux.Vars(req)["code"])
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: "Method type deleted"}, http.StatusOK)
+}
+
+// FundTypePutHandler create or replace a fund type of the client catalog
+func (h *AppHandler) FundTypePutHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	// init empty fund type
+	f := models.FundType{}
+	if req.ContentLength != 0 {
+		err := json.NewDecoder(req.Body).Decode(&f)
+		if err != nil {
+			response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	f.ClientID = clientID
+	f.Code = mux.Vars(req)["code"]
+
+	err := h.db.SetFundType(&f)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &f}, http.StatusOK)
+}
+
+// FundTypeGetAllHandler return the fund type catalog of the client
+func (h *AppHandler) FundTypeGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	funds, err := h.db.GetAllFundType(clientID)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &funds}, http.StatusOK)
+}
+
+// FundTypeDeleteHandler remove a fund type from the client catalog
+func (h *AppHandler) FundTypeDeleteHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	err := h.db.DeleteFundType(clientID, mux.Vars(req)["code"])
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: "Fund type deleted"}, http.StatusOK)
+}
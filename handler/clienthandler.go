@@ -34,6 +34,12 @@ func (h *AppHandler) ClientPostHandler(w http.ResponseWriter, req *http.Request)
 		Address:   req.PostFormValue("address"),
 		URL:       req.PostFormValue("url"),
 		Reference: req.PostFormValue("reference"),
+		// empty uses models.DefaultCurrency
+		DefaultCurrency: req.PostFormValue("defaultCurrency"),
+	}
+	if c.UniqueFundType, err = boolParam(req.PostFormValue("uniqueFundType")); err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid uniqueFundType"}, http.StatusBadRequest)
+		return
 	}
 
 	id, err := h.db.CreateClient(c)
@@ -65,13 +71,24 @@ func (h *AppHandler) ClientGetHandler(w http.ResponseWriter, req *http.Request)
 
 // ClientGetAllHandler returns array of client objects
 func (h *AppHandler) ClientGetAllHandler(w http.ResponseWriter, req *http.Request) {
-	clients, err := h.db.GetAllClient()
+	pr, err := pageRequest(req)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	f := models.ClientFilter{Name: req.URL.Query().Get("name")}
+	if f.IsActive, err = boolParam(req.URL.Query().Get("isActive")); err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid isActive"}, http.StatusBadRequest)
+		return
+	}
+
+	clients, paging, err := h.db.GetClientPage(&f, pr)
 	if err != nil {
 		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 
-	response.JSON(w, SuccessResponse{Data: &clients}, http.StatusOK)
+	response.JSON(w, SuccessResponse{Data: &clients, Paging: paging}, http.StatusOK)
 }
 
 // ClientPutHandler update client object
@@ -120,6 +137,13 @@ func (h *AppHandler) ClientPutHandler(w http.ResponseWriter, req *http.Request)
 		c.Reference = reference
 	}
 
+	// empty keeps the current default currency and wallet uniqueness
+	c.DefaultCurrency = req.PostFormValue("defaultCurrency")
+	if c.UniqueFundType, err = boolParam(req.PostFormValue("uniqueFundType")); err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid uniqueFundType"}, http.StatusBadRequest)
+		return
+	}
+
 	res, err := h.db.UpdateClientByUUID(uuid, c)
 	if err != nil {
 		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
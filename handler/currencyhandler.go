@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+)
+
+// CurrencyPostHandler add or update a currency of the registry
+func (h *AppHandler) CurrencyPostHandler(w http.ResponseWriter, req *http.Request) {
+	// init empty currency
+	c := models.Currency{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&c)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if len(c.Code) != 3 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "3 letter currency code required"}, http.StatusBadRequest)
+		return
+	}
+	if c.MinorUnits < 0 || c.MinorUnits > models.AmountScale {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "minorUnits must be between 0 and 4"}, http.StatusBadRequest)
+		return
+	}
+
+	err = h.db.CreateCurrency(&c)
+	if err == models.ErrCurrencyInUse {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &c}, http.StatusOK)
+}
+
+// CurrencyGetAllHandler return the currency registry
+func (h *AppHandler) CurrencyGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	currencies, err := h.db.GetAllCurrency()
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &currencies}, http.StatusOK)
+}
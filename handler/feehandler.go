@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+	"github.com/gorilla/mux"
+)
+
+// FeePostHandler create or replace the fee schedule of a method type
+func (h *AppHandler) FeePostHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	// init empty fee schedule
+	s := models.FeeSchedule{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&s)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	s.ClientID = clientID
+
+	err = h.db.SetFeeSchedule(&s)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &s}, http.StatusOK)
+}
+
+// FeeGetAllHandler return the fee schedules of the client
+func (h *AppHandler) FeeGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	schedules, err := h.db.GetAllFeeSchedule(clientID)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &schedules}, http.StatusOK)
+}
+
+// FeeDeleteHandler remove a fee schedule of the client
+func (h *AppHandler) FeeDeleteHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+	scheduleID, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid fee schedule id"}, http.StatusBadRequest)
+		return
+	}
+
+	err = h.db.DeleteFeeSchedule(clientID, scheduleID)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: "Fee schedule deleted"}, http.StatusOK)
+}
+
+// FeePreviewGetHandler quote the fee of a cr/dr on the e-Wallet before posting it,
+// e.g. ?transactionType=dr&methodType=withdrawal&amount=100
+func (h *AppHandler) FeePreviewGetHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	q := req.URL.Query()
+	amt, err := models.ParseAmount(q.Get("amount"))
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid amount"}, http.StatusBadRequest)
+		return
+	}
+
+	fee, err := h.db.PreviewFee(clientID, guid, q.Get("transactionType"), q.Get("methodType"), amt)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: fee}, http.StatusOK)
+}
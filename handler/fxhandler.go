@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+)
+
+// exchangeRequest is the body of an exchange, either a quote code or the exchange details
+type exchangeRequest struct {
+	QuoteCode string `json:"quoteCode"`
+	models.FXQuote
+}
+
+// FXRatePostHandler add a rate to the exchange rate table
+func (h *AppHandler) FXRatePostHandler(w http.ResponseWriter, req *http.Request) {
+	// init empty rate
+	rate := models.FXRate{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&rate)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if rate.Base == "" || rate.Quote == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "base and quote currency required"}, http.StatusBadRequest)
+		return
+	}
+
+	err = h.db.CreateFXRate(&rate)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &rate}, http.StatusOK)
+}
+
+// FXRateGetAllHandler return the exchange rate table, filtered by ?base= and ?quote=
+func (h *AppHandler) FXRateGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	rates, err := h.db.GetAllFXRate(q.Get("base"), q.Get("quote"))
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &rates}, http.StatusOK)
+}
+
+// FXQuotePostHandler quote an exchange between two e-Wallets and lock the rate for QuoteTTL
+func (h *AppHandler) FXQuotePostHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	// init empty quote
+	quote := models.FXQuote{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&quote)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	quote.ClientID = clientID
+	if !validExchange(w, &quote) {
+		return
+	}
+
+	err = h.db.CreateFXQuote(&quote, h.QuoteTTL)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &quote}, http.StatusOK)
+}
+
+// FXExchangePostHandler execute a quote, or quote and execute at once when no quoteCode is given
+func (h *AppHandler) FXExchangePostHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	// init empty exchange
+	exchange := exchangeRequest{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&exchange)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	quote := &exchange.FXQuote
+	if exchange.QuoteCode != "" {
+		quote, err = h.db.ExecuteFXQuote(clientID, exchange.QuoteCode)
+	} else {
+		quote.ClientID = clientID
+		if !validExchange(w, quote) {
+			return
+		}
+		err = h.db.Exchange(quote)
+	}
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: quote}, http.StatusOK)
+}
+
+// validExchange check the exchange details, on error the response is written
+func validExchange(w http.ResponseWriter, quote *models.FXQuote) bool {
+	if quote.Source == "" || quote.Destination == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Source and destination e-Wallet address required"}, http.StatusBadRequest)
+		return false
+	}
+	if quote.SourceAmount <= 0 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "sourceAmount must be over zero (0)"}, http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
@@ -1,34 +1,89 @@
 package handler
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 
 	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
 )
 
 // AppHandler is the class of Application Handler
 type AppHandler struct {
 	db *models.DB
+	// HoldTTL is how long an authorized hold reserves funds before it expires
+	HoldTTL time.Duration
+	// QuoteTTL is how long an exchange quote locks its rate
+	QuoteTTL time.Duration
+	// AdminToken guards the admin routes, empty refuses them all
+	AdminToken string
 }
 
 // ErrResponse struct for Error Response (JSON)
 type ErrResponse struct {
 	Err     string `json:"error"`
 	Message string `json:"message"`
+	// Code and Details are set for errors a caller can act on, e.g. LIMIT_EXCEEDED
+	Code    string      `json:"code,omitempty"`
+	Details interface{} `json:"details,omitempty"`
 }
 
 // SuccessResponse struct for Success Response (JSON)
 type SuccessResponse struct {
 	Data interface{} `json:"data"`
+	// Paging carries the next/prev cursors of a paged listing
+	Paging *models.Paging `json:"paging,omitempty"`
 }
 
 // NewHandler create a Application Handler class
 func NewHandler(db *models.DB) *AppHandler {
-	return &AppHandler{db: db}
+	return &AppHandler{db: db, HoldTTL: 15 * time.Minute, QuoteTTL: 30 * time.Second}
+}
+
+// clientVars read the client uuid of the route, on error the response is written
+func (h *AppHandler) clientVars(w http.ResponseWriter, req *http.Request) (int, bool) {
+	uuid := mux.Vars(req)["uuid"]
+	if uuid == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid client uuid"}, http.StatusBadRequest)
+		return 0, false
+	}
+	// get client ID from given uuid
+	clientID, _ := h.db.GetClientIDByUUID(uuid)
+	if clientID == 0 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid client uuid"}, http.StatusBadRequest)
+		return 0, false
+	}
+
+	return clientID, true
+}
+
+// walletVars read the client uuid and e-Wallet address of the route, on error the response is written
+func (h *AppHandler) walletVars(w http.ResponseWriter, req *http.Request) (int, string, bool) {
+	vars := mux.Vars(req)
+	uuid := vars["uuid"]
+	if uuid == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid client uuid"}, http.StatusBadRequest)
+		return 0, "", false
+	}
+	// e-Wallet address
+	guid := vars["guid"]
+	if guid == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Client e-Wallet address required"}, http.StatusBadRequest)
+		return 0, "", false
+	}
+	// get client ID from given uuid
+	clientID, _ := h.db.GetClientIDByUUID(uuid)
+	if clientID == 0 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid client uuid"}, http.StatusBadRequest)
+		return 0, "", false
+	}
+
+	return clientID, guid, true
 }
 
 // Logger middleware
@@ -40,6 +95,19 @@ func (h *AppHandler) Logger(next http.Handler) http.Handler {
 	})
 }
 
+// WithAdminMiddleware requires the request to carry the admin token before allowing to proceed
+func (h *AppHandler) WithAdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if h.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.AdminToken)) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 // WithTokenMiddleware requires the request to have a valid token before allowing to proceed
 func (h *AppHandler) WithTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
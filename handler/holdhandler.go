@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+)
+
+// captureRequest is the optional body of a hold capture
+type captureRequest struct {
+	Amount      models.Amount `json:"amount"`
+	Particulars string        `json:"particulars"`
+}
+
+// HoldPostHandler authorize a hold on the e-Wallet available balance
+func (h *AppHandler) HoldPostHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	// init empty hold
+	hold := models.Hold{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&hold)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	hold.ClientID = clientID
+	hold.Address = guid
+	// validate if amount is more than zero
+	if hold.Amount <= 0 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "amount must be over zero (0)"}, http.StatusBadRequest)
+		return
+	}
+	// validate if methodType is not empty
+	if hold.MethodType == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Method type required"}, http.StatusBadRequest)
+		return
+	}
+
+	err = h.db.AuthorizeHold(&hold, h.HoldTTL)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &hold}, http.StatusOK)
+}
+
+// HoldGetAllHandler return the holds of the e-Wallet
+func (h *AppHandler) HoldGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	holds, err := h.db.GetAllHoldByIDGUID(clientID, guid)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &holds}, http.StatusOK)
+}
+
+// HoldCapturePostHandler debit all or part of a hold and release the rest
+func (h *AppHandler) HoldCapturePostHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	// body is optional, no amount captures the full hold
+	capture := captureRequest{}
+	if req.ContentLength != 0 {
+		err := json.NewDecoder(req.Body).Decode(&capture)
+		if err != nil {
+			response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	if capture.Amount < 0 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "amount must be over zero (0)"}, http.StatusBadRequest)
+		return
+	}
+
+	hold, err := h.db.CaptureHold(clientID, guid, mux.Vars(req)["code"], capture.Amount, capture.Particulars)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: hold}, http.StatusOK)
+}
+
+// HoldVoidPostHandler release a hold without debiting the e-Wallet
+func (h *AppHandler) HoldVoidPostHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	hold, err := h.db.VoidHold(clientID, guid, mux.Vars(req)["code"])
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: hold}, http.StatusOK)
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/avecost/ewallet/response"
+)
+
+// AccountGetAllHandler return the ledger accounts of the client with their posted balance
+func (h *AppHandler) AccountGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	accounts, err := h.db.GetAllAccount(clientID)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &accounts}, http.StatusOK)
+}
+
+// WalletLedgerGetHandler prove the e-Wallet balance from its ledger postings
+func (h *AppHandler) WalletLedgerGetHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	l, err := h.db.GetWalletLedger(clientID, guid)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: l}, http.StatusOK)
+}
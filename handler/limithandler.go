@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+)
+
+// LimitPostHandler create or replace the limits of a client, fund type or e-Wallet scope
+func (h *AppHandler) LimitPostHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	// init empty limit
+	l := models.Limit{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&l)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	l.ClientID = clientID
+
+	err = h.db.SetLimit(&l)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &l}, http.StatusOK)
+}
+
+// LimitGetAllHandler return the limits configured by the client
+func (h *AppHandler) LimitGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	limits, err := h.db.GetAllLimit(clientID)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &limits}, http.StatusOK)
+}
+
+// HeadroomGetHandler return the effective limits of the e-Wallet and what is left of each
+func (h *AppHandler) HeadroomGetHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	headroom, err := h.db.GetHeadroom(clientID, guid)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: headroom}, http.StatusOK)
+}
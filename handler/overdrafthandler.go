@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+)
+
+// repayRequest is the optional body of an overdraft repayment
+type repayRequest struct {
+	Amount models.Amount `json:"amount"`
+}
+
+// OverdraftPutHandler set the credit limit and credit rule of the e-Wallet
+func (h *AppHandler) OverdraftPutHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	// init empty overdraft
+	o := models.Overdraft{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&o)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	wallet, err := h.db.SetOverdraft(clientID, guid, &o)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: wallet}, http.StatusOK)
+}
+
+// OverdraftRepayPostHandler repay the drawn overdraft from the e-Wallet money, no amount repays all it can
+func (h *AppHandler) OverdraftRepayPostHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	repay := repayRequest{}
+	if req.ContentLength != 0 {
+		err := json.NewDecoder(req.Body).Decode(&repay)
+		if err != nil {
+			response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	wallet, err := h.db.RepayOverdraft(clientID, guid, repay.Amount)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: wallet}, http.StatusOK)
+}
+
+// OverdraftGetAllHandler report the e-Wallets of the client currently in overdraft
+func (h *AppHandler) OverdraftGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	wallets, err := h.db.GetAllOverdraft(clientID)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &wallets}, http.StatusOK)
+}
@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/avecost/ewallet/models"
+)
+
+// pageRequest read the cursor, limit and sort (asc or desc, desc by default) query parameters
+func pageRequest(req *http.Request) (models.PageRequest, error) {
+	q := req.URL.Query()
+	pr := models.PageRequest{Cursor: q.Get("cursor"), Desc: true}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return pr, errors.New("limit must be over zero (0)")
+		}
+		pr.Limit = limit
+	}
+	switch q.Get("sort") {
+	case "", "desc":
+	case "asc":
+		pr.Desc = false
+	default:
+		return pr, errors.New("sort must be asc or desc")
+	}
+
+	return pr, nil
+}
+
+// boolParam read an optional true/false query parameter, nil when empty
+func boolParam(v string) (*bool, error) {
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
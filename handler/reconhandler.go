@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+)
+
+// resolveRequest is the body of a break resolution
+type resolveRequest struct {
+	Note string `json:"note"`
+}
+
+// ReconBreakGetAllHandler return the unresolved reconciliation breaks of the client
+func (h *AppHandler) ReconBreakGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	breaks, err := h.db.GetAllReconBreak(clientID)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &breaks}, http.StatusOK)
+}
+
+// ReconBreakResolvePostHandler mark a break as resolved with the investigation note, only with the admin token
+func (h *AppHandler) ReconBreakResolvePostHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+	breakID, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid break id"}, http.StatusBadRequest)
+		return
+	}
+
+	resolve := resolveRequest{}
+	err = json.NewDecoder(req.Body).Decode(&resolve)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	// validate if note is not empty
+	if resolve.Note == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Note required"}, http.StatusBadRequest)
+		return
+	}
+
+	b, err := h.db.ResolveReconBreak(clientID, breakID, resolve.Note)
+	if err == models.ErrBreakNotFound {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Internal server error"}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: b}, http.StatusOK)
+}
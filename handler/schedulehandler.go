@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+	"github.com/gorilla/mux"
+)
+
+// SchedulePostHandler create a scheduled cr/dr on the e-Wallet with a cron or interval recurrence
+func (h *AppHandler) SchedulePostHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	// init empty schedule
+	s := models.Schedule{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&s)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	s.ClientID = clientID
+	s.Address = guid
+	// validate methodType against the client catalog
+	if err = h.db.CheckMethodType(clientID, s.MethodType, s.TransactionType); err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	err = h.db.CreateSchedule(&s)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &s}, http.StatusOK)
+}
+
+// ScheduleGetAllHandler return the schedules of the e-Wallet
+func (h *AppHandler) ScheduleGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	schedules, err := h.db.GetAllSchedule(clientID, guid)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &schedules}, http.StatusOK)
+}
+
+// ScheduleRunGetAllHandler return the run history of a schedule
+func (h *AppHandler) ScheduleRunGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+	scheduleID, ok := scheduleVar(w, req)
+	if !ok {
+		return
+	}
+
+	runs, err := h.db.GetAllScheduleRun(clientID, guid, scheduleID)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &runs}, http.StatusOK)
+}
+
+// ScheduleActionPostHandler pause, resume or cancel a schedule
+func (h *AppHandler) ScheduleActionPostHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+	scheduleID, ok := scheduleVar(w, req)
+	if !ok {
+		return
+	}
+
+	var s *models.Schedule
+	var err error
+	switch mux.Vars(req)["action"] {
+	case "pause":
+		s, err = h.db.PauseSchedule(clientID, guid, scheduleID)
+	case "resume":
+		s, err = h.db.ResumeSchedule(clientID, guid, scheduleID)
+	case "cancel":
+		s, err = h.db.CancelSchedule(clientID, guid, scheduleID)
+	default:
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Unknown schedule action"}, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: s}, http.StatusOK)
+}
+
+// scheduleVar read the schedule id of the route
+func scheduleVar(w http.ResponseWriter, req *http.Request) (int, bool) {
+	scheduleID, err := strconv.Atoi(mux.Vars(req)["id"])
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid schedule id"}, http.StatusBadRequest)
+		return 0, false
+	}
+
+	return scheduleID, true
+}
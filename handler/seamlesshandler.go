@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+)
+
+// endRoundRequest is the body of endRound
+type endRoundRequest struct {
+	Address string `json:"address"`
+	RoundID string `json:"roundId"`
+}
+
+// SeamlessBetHandler handle the game provider bet (debit)
+func (h *AppHandler) SeamlessBetHandler(w http.ResponseWriter, req *http.Request) {
+	h.seamless(w, req, true, h.db.SeamlessBet)
+}
+
+// SeamlessWinHandler handle the game provider win (credit)
+func (h *AppHandler) SeamlessWinHandler(w http.ResponseWriter, req *http.Request) {
+	h.seamless(w, req, false, h.db.SeamlessWin)
+}
+
+// SeamlessRollbackHandler handle the game provider rollback of a bet
+func (h *AppHandler) SeamlessRollbackHandler(w http.ResponseWriter, req *http.Request) {
+	h.seamless(w, req, false, h.db.SeamlessRollback)
+}
+
+// SeamlessEndRoundHandler close a game round
+func (h *AppHandler) SeamlessEndRoundHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	// init empty request
+	end := endRoundRequest{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&end)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if end.Address == "" || end.RoundID == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "address and roundId required"}, http.StatusBadRequest)
+		return
+	}
+
+	round, err := h.db.EndRound(clientID, end.Address, end.RoundID)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: round}, http.StatusOK)
+}
+
+// SeamlessRoundGetHandler return a game round with its linked transactions
+func (h *AppHandler) SeamlessRoundGetHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	round, err := h.db.GetRound(clientID, mux.Vars(req)["roundId"])
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: round}, http.StatusOK)
+}
+
+// seamless decode and validate a seamless request then run op on it
+func (h *AppHandler) seamless(w http.ResponseWriter, req *http.Request, needAmount bool,
+	op func(*models.SeamlessRequest) (*models.SeamlessResult, error)) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+
+	// init empty request
+	sr := models.SeamlessRequest{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&sr)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	sr.ClientID = clientID
+	if sr.Address == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Client e-Wallet address required"}, http.StatusBadRequest)
+		return
+	}
+	if sr.ProviderTxID == "" || sr.RoundID == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "providerTxId and roundId required"}, http.StatusBadRequest)
+		return
+	}
+	// a win can be zero (lost round), a bet must be over zero
+	if sr.Amount < 0 || (needAmount && sr.Amount == 0) {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "amount must be over zero (0)"}, http.StatusBadRequest)
+		return
+	}
+
+	res, err := op(&sr)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: res}, http.StatusOK)
+}
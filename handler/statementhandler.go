@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+)
+
+// dateLayout is the day format accepted by the date range parameters
+const dateLayout = "2006-01-02"
+
+// WalletStatementGetHandler return the e-Wallet statement for ?from=&to=, the current month by
+// default. A day in to includes the whole day. ?format=csv or Accept: text/csv returns a CSV file.
+func (h *AppHandler) WalletStatementGetHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, guid, ok := h.walletVars(w, req)
+	if !ok {
+		return
+	}
+
+	now := time.Now().Local()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := from.AddDate(0, 1, 0)
+	var err error
+	q := req.URL.Query()
+	if v := q.Get("from"); v != "" {
+		if from, err = parseDateParam(v, false); err != nil {
+			response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid from date"}, http.StatusBadRequest)
+			return
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = parseDateParam(v, true); err != nil {
+			response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid to date"}, http.StatusBadRequest)
+			return
+		}
+	}
+	if !to.After(from) {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "to must be after from"}, http.StatusBadRequest)
+		return
+	}
+
+	st, err := h.db.GetStatement(clientID, guid, from, to)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	if q.Get("format") == "csv" || strings.Contains(req.Header.Get("Accept"), "text/csv") {
+		response.CSV(w, "statement-"+guid+"-"+from.Format(dateLayout)+".csv", statementRecords(st), http.StatusOK)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: st}, http.StatusOK)
+}
+
+// parseDateParam read a day or an RFC 3339 time, a day read as end is the start of the next day
+func parseDateParam(v string, end bool) (time.Time, error) {
+	if t, err := time.ParseInLocation(dateLayout, v, time.Local); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	return time.Parse(time.RFC3339, v)
+}
+
+// statementRecords lay the statement out as CSV rows framed by the opening and closing balances
+func statementRecords(st *models.Statement) [][]string {
+	records := [][]string{
+		{"date", "referenceCode", "transactionType", "methodType", "particulars", "credit", "debit", "balance"},
+		{st.From.Format(time.RFC3339), "", "", "", "Opening balance", "", "", st.OpeningBalance.String()},
+	}
+	for _, t := range st.Transactions {
+		records = append(records, []string{t.TransactionAt.Format(time.RFC3339), t.ReferenceCode, t.TransactionType,
+			t.MethodType, t.Particulars, t.CrAmount.String(), t.DrAmount.String(), t.NewBalance.String()})
+	}
+
+	return append(records, []string{st.To.Format(time.RFC3339), "", "", "", "Closing balance",
+		st.TotalCredits.String(), st.TotalDebits.String(), st.ClosingBalance.String()})
+}
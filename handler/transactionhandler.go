@@ -2,7 +2,7 @@ package handler
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
 	"net/http"
 
 	"github.com/avecost/ewallet/models"
@@ -47,7 +47,7 @@ func (h *AppHandler) CreditPostHandler(w http.ResponseWriter, req *http.Request)
 	creditTransact.ClientID = clientID
 	creditTransact.Address = guid
 	// validate if crAmount is more than zero
-	if creditTransact.CrAmount == 0 {
+	if creditTransact.CrAmount <= 0 {
 		response.JSON(w, ErrResponse{Err: "Application Error", Message: "crAmount must be over zero (0)"}, http.StatusBadRequest)
 		return
 	}
@@ -56,25 +56,20 @@ func (h *AppHandler) CreditPostHandler(w http.ResponseWriter, req *http.Request)
 		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Method type required"}, http.StatusBadRequest)
 		return
 	}
-
-	// Create Credit transaction
-	id, err := h.db.CreateCreditTransaction(&creditTransact)
-	if err != nil {
-		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Internal server error"}, http.StatusBadRequest)
+	// validate methodType against the client catalog
+	if err = h.db.CheckMethodType(clientID, creditTransact.MethodType, "cr"); err != nil {
+		writePostingError(w, err)
 		return
 	}
 
-	// credit the Wallet Balance
-	oldBalance, newBalance, err := h.db.CreditWalletByIDGUID(clientID, guid, creditTransact.CrAmount)
+	// post the Credit transaction and Wallet Balance together
+	crTransact, err := h.db.PostCreditTransaction(&creditTransact, idempotencyKey(req, &creditTransact))
 	if err != nil {
-		fmt.Println(err.Error())
+		writePostingError(w, err)
+		return
 	}
-	// get all info about the transaction
-	crTransact, _ := h.db.GetTransactionByID(id)
-	crTransact.OldBalance = *oldBalance
-	crTransact.NewBalance = *newBalance
 
-	response.JSON(w, SuccessResponse{Data: &crTransact}, http.StatusOK)
+	response.JSON(w, SuccessResponse{Data: crTransact}, http.StatusOK)
 }
 
 // DebitPostHandler handle the e-Wallet Debit
@@ -114,7 +109,7 @@ func (h *AppHandler) DebitPostHandler(w http.ResponseWriter, req *http.Request)
 	debitTransact.ClientID = clientID
 	debitTransact.Address = guid
 	// validate if crAmount is more than zero
-	if debitTransact.DrAmount == 0 {
+	if debitTransact.DrAmount <= 0 {
 		response.JSON(w, ErrResponse{Err: "Application Error", Message: "drAmount must be over zero (0)"}, http.StatusBadRequest)
 		return
 	}
@@ -123,31 +118,70 @@ func (h *AppHandler) DebitPostHandler(w http.ResponseWriter, req *http.Request)
 		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Method type required"}, http.StatusBadRequest)
 		return
 	}
-	// check if has balance for the debit amt
-	if !h.db.IsBalanceEnoughForDebit(clientID, guid, debitTransact.DrAmount) {
-		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Insufficient e-Wallet balance"}, http.StatusBadRequest)
+	// validate methodType against the client catalog
+	if err = h.db.CheckMethodType(clientID, debitTransact.MethodType, "dr"); err != nil {
+		writePostingError(w, err)
 		return
 	}
-
-	// create Debit transaction
-	id, err := h.db.CreateDebitTransaction(&debitTransact)
+	// post the Debit transaction and Wallet Balance together, balance is checked inside
+	drTransact, err := h.db.PostDebitTransaction(&debitTransact, idempotencyKey(req, &debitTransact))
 	if err != nil {
-		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Internal server error"}, http.StatusBadRequest)
+		writePostingError(w, err)
 		return
 	}
 
-	// debit the Wallet Balance
-	oldBalance, newBalance, err := h.db.DebitWalletByIDGUID(clientID, guid, debitTransact.DrAmount)
+	response.JSON(w, SuccessResponse{Data: drTransact}, http.StatusOK)
+}
+
+// ReversalPostHandler handle the full or partial reversal of a posted e-Wallet transaction
+func (h *AppHandler) ReversalPostHandler(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	uuid := vars["uuid"]
+	if uuid == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid client uuid"}, http.StatusBadRequest)
+		return
+	}
+	// e-Wallet address
+	guid := vars["guid"]
+	if guid == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Client e-Wallet address required"}, http.StatusBadRequest)
+		return
+	}
+	// get client ID from given uuid
+	clientID, _ := h.db.GetClientIDByUUID(uuid)
+	if clientID == 0 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid client uuid"}, http.StatusBadRequest)
+		return
+	}
+
+	// init empty reversal
+	reversal := models.Reversal{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&reversal)
 	if err != nil {
 		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
-	// get all info about the transaction
-	drTransact, _ := h.db.GetTransactionByID(id)
-	drTransact.OldBalance = *oldBalance
-	drTransact.NewBalance = *newBalance
+	reversal.ClientID = clientID
+	reversal.Address = guid
+	// validate if referenceCode is not empty
+	if reversal.ReferenceCode == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Reference code required"}, http.StatusBadRequest)
+		return
+	}
+	// amount is optional but can not be negative
+	if reversal.Amount < 0 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "amount must be over zero (0)"}, http.StatusBadRequest)
+		return
+	}
+
+	rvTransact, err := h.db.PostReversal(&reversal)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
 
-	response.JSON(w, SuccessResponse{Data: &drTransact}, http.StatusOK)
+	response.JSON(w, SuccessResponse{Data: rvTransact}, http.StatusOK)
 }
 
 // GetAllTransactionHandler return all transaction of e-Wallet Address
@@ -176,11 +210,130 @@ func (h *AppHandler) GetAllTransactionHandler(w http.ResponseWriter, req *http.R
 		return
 	}
 
-	ts, err := h.db.GetAllTransactionByIDGUID(clientID, guid)
+	pr, err := pageRequest(req)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	f, err := transactionFilter(req)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	ts, paging, err := h.db.GetTransactionPageByIDGUID(clientID, guid, f, pr)
 	if err != nil {
 		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 
-	response.JSON(w, SuccessResponse{Data: &ts}, http.StatusOK)
+	response.JSON(w, SuccessResponse{Data: &ts, Paging: paging}, http.StatusOK)
+}
+
+// transactionFilter read the listing filters: from, to, transactionType, methodType, referenceCode,
+// minAmount and maxAmount
+func transactionFilter(req *http.Request) (*models.TransactionFilter, error) {
+	var err error
+	f := models.TransactionFilter{}
+	q := req.URL.Query()
+
+	if v := q.Get("from"); v != "" {
+		if f.From, err = parseDateParam(v, false); err != nil {
+			return nil, errors.New("Invalid from date")
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if f.To, err = parseDateParam(v, true); err != nil {
+			return nil, errors.New("Invalid to date")
+		}
+	}
+	f.TransactionType = q.Get("transactionType")
+	if f.TransactionType != "" && f.TransactionType != "cr" && f.TransactionType != "dr" {
+		return nil, errors.New("transactionType must be cr or dr")
+	}
+	f.MethodType = q.Get("methodType")
+	f.ReferenceCode = q.Get("referenceCode")
+	if v := q.Get("minAmount"); v != "" {
+		a, err := models.ParseAmount(v)
+		if err != nil {
+			return nil, errors.New("Invalid minAmount")
+		}
+		f.MinAmount = &a
+	}
+	if v := q.Get("maxAmount"); v != "" {
+		a, err := models.ParseAmount(v)
+		if err != nil {
+			return nil, errors.New("Invalid maxAmount")
+		}
+		f.MaxAmount = &a
+	}
+
+	return &f, nil
+}
+
+// TransactionLookupGetHandler return a transaction and its e-Wallet by reference code or external reference
+func (h *AppHandler) TransactionLookupGetHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+	ref := mux.Vars(req)["referenceCode"]
+	if ref == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Reference code required"}, http.StatusBadRequest)
+		return
+	}
+
+	t, wallet, err := h.db.GetTransactionByReference(clientID, ref)
+	if err == models.ErrTransactionNotFound {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Internal server error"}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: transactionLookup{Transaction: t, Wallet: wallet}}, http.StatusOK)
+}
+
+// transactionLookup is the answer of a transaction lookup
+type transactionLookup struct {
+	Transaction *models.Transaction `json:"transaction"`
+	Wallet      *models.Wallet      `json:"wallet"`
+}
+
+// idempotencyKey return the Idempotency-Key header, or the client externalReference when not given
+func idempotencyKey(req *http.Request, t *models.Transaction) string {
+	if key := req.Header.Get("Idempotency-Key"); key != "" {
+		return key
+	}
+
+	return t.ExternalReference
+}
+
+// writePostingError respond with the client facing message of a posting error
+func writePostingError(w http.ResponseWriter, err error) {
+	if le, ok := err.(*models.LimitError); ok {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: le.Error(), Code: le.Code, Details: le}, http.StatusBadRequest)
+		return
+	}
+
+	switch err {
+	case models.ErrWalletNotActive, models.ErrInsufficientBalance, models.ErrSameWallet,
+		models.ErrTransactionNotFound, models.ErrReversalOfReversal, models.ErrReversalExceedsOriginal,
+		models.ErrReversalOfTransfer, models.ErrHoldNotActive, models.ErrCaptureExceedsHold,
+		models.ErrRoundClosed, models.ErrBetRolledBack, models.ErrRoundNotFound, models.ErrRoundOtherWallet,
+		models.ErrUnknownCurrency, models.ErrCurrencyMismatch, models.ErrAmountPrecision,
+		models.ErrFXRateNotFound, models.ErrFXSameCurrency, models.ErrFXDifferentUser, models.ErrQuoteNotOpen,
+		models.ErrInvalidLimit, models.ErrInvalidAmount, models.ErrUnknownBucket, models.ErrBucketBreakdown,
+		models.ErrInvalidExpiry, models.ErrInvalidBonus, models.ErrBonusLocked, models.ErrInvalidFee, models.ErrFeeNotFound,
+		models.ErrUnknownMethodType, models.ErrUnknownFundType, models.ErrInvalidCatalogEntry, models.ErrCatalogEntryNotFound,
+		models.ErrInvalidSchedule, models.ErrInvalidCron, models.ErrScheduleNotFound, models.ErrScheduleStatus,
+		models.ErrReservedIdempotencyKey:
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+	case models.ErrIdempotencyConflict:
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusConflict)
+	default:
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Internal server error"}, http.StatusBadRequest)
+	}
 }
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+)
+
+// TransferPostHandler handle the transfer of funds between two e-Wallets of the client
+func (h *AppHandler) TransferPostHandler(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	uuid := vars["uuid"]
+	if uuid == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid client uuid"}, http.StatusBadRequest)
+		return
+	}
+	// get client ID from given uuid
+	clientID, _ := h.db.GetClientIDByUUID(uuid)
+	if clientID == 0 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid client uuid"}, http.StatusBadRequest)
+		return
+	}
+
+	// init empty transfer
+	transfer := models.Transfer{}
+	// decode the pass json object
+	err := json.NewDecoder(req.Body).Decode(&transfer)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	transfer.ClientID = clientID
+	// validate both e-Wallet address are given
+	if transfer.Source == "" || transfer.Destination == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Source and destination e-Wallet address required"}, http.StatusBadRequest)
+		return
+	}
+	// validate if amount is more than zero
+	if transfer.Amount <= 0 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "amount must be over zero (0)"}, http.StatusBadRequest)
+		return
+	}
+	// validate if methodType is not empty
+	if transfer.MethodType == "" {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Method type required"}, http.StatusBadRequest)
+		return
+	}
+
+	// post both legs of the transfer together
+	err = h.db.PostTransfer(&transfer)
+	if err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &transfer}, http.StatusOK)
+}
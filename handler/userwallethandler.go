@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/avecost/ewallet/models"
+	"github.com/avecost/ewallet/response"
+)
+
+// UserWalletGetAllHandler return the wallets of an end-user, optionally of one fund type
+func (h *AppHandler) UserWalletGetAllHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(req)
+	userID, err := strconv.Atoi(vars["userID"])
+	if err != nil || userID == 0 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid userID"}, http.StatusBadRequest)
+		return
+	}
+
+	wallets, err := h.db.GetAllWalletByUserID(clientID, userID, vars["fundType"])
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if len(wallets) == 0 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "e-Wallet not found"}, http.StatusNotFound)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &wallets}, http.StatusOK)
+}
+
+// UserWalletPutHandler get the wallet of the end-user and fund type, creating it when missing.
+// The optional body gives the currency, tag and credit settings of a new wallet.
+func (h *AppHandler) UserWalletPutHandler(w http.ResponseWriter, req *http.Request) {
+	clientID, ok := h.clientVars(w, req)
+	if !ok {
+		return
+	}
+	vars := mux.Vars(req)
+	userID, err := strconv.Atoi(vars["userID"])
+	if err != nil || userID == 0 {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: "Invalid userID"}, http.StatusBadRequest)
+		return
+	}
+
+	// init empty wallet
+	wallet := models.Wallet{}
+	if req.ContentLength != 0 {
+		err = json.NewDecoder(req.Body).Decode(&wallet)
+		if err != nil {
+			response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+			return
+		}
+	}
+	wallet.ClientID = clientID
+	wallet.UserID = userID
+	wallet.FundType = vars["fundType"]
+	// validate fundType against the client catalog
+	if err = h.db.CheckFundType(clientID, wallet.FundType); err != nil {
+		writePostingError(w, err)
+		return
+	}
+
+	newWallet, created, err := h.db.GetOrCreateWallet(&wallet)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if created {
+		response.JSON(w, SuccessResponse{Data: newWallet}, http.StatusCreated)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: newWallet}, http.StatusOK)
+}
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 
@@ -42,8 +44,17 @@ func (h *AppHandler) WalletPostHandler(w http.ResponseWriter, req *http.Request)
 	if wallet.FundType == "" {
 		wallet.FundType = "default"
 	}
+	// validate fundType against the client catalog
+	if err = h.db.CheckFundType(clientID, wallet.FundType); err != nil {
+		writePostingError(w, err)
+		return
+	}
 	// Create Wallet
 	id, err := h.db.CreateWallet(&wallet)
+	if err == models.ErrWalletExists {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusConflict)
+		return
+	}
 	if err != nil {
 		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
 		return
@@ -100,13 +111,58 @@ func (h *AppHandler) WalletGetAllHandler(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	wallets, err := h.db.GetAllWallet(clientID)
+	pr, err := pageRequest(req)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	f, err := walletFilter(req)
 	if err != nil {
 		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
 		return
 	}
 
-	response.JSON(w, SuccessResponse{Data: &wallets}, http.StatusOK)
+	wallets, paging, err := h.db.GetWalletPage(clientID, f, pr)
+	if err != nil {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
+		return
+	}
+
+	response.JSON(w, SuccessResponse{Data: &wallets, Paging: paging}, http.StatusOK)
+}
+
+// walletFilter read the listing filters: userID, fundType, tag, isActive, minBalance and maxBalance
+func walletFilter(req *http.Request) (*models.WalletFilter, error) {
+	var err error
+	f := models.WalletFilter{}
+	q := req.URL.Query()
+
+	if v := q.Get("userID"); v != "" {
+		if f.UserID, err = strconv.Atoi(v); err != nil {
+			return nil, errors.New("Invalid userID")
+		}
+	}
+	f.FundType = q.Get("fundType")
+	f.Tag = q.Get("tag")
+	if f.IsActive, err = boolParam(q.Get("isActive")); err != nil {
+		return nil, errors.New("Invalid isActive")
+	}
+	if v := q.Get("minBalance"); v != "" {
+		a, err := models.ParseAmount(v)
+		if err != nil {
+			return nil, errors.New("Invalid minBalance")
+		}
+		f.MinBalance = &a
+	}
+	if v := q.Get("maxBalance"); v != "" {
+		a, err := models.ParseAmount(v)
+		if err != nil {
+			return nil, errors.New("Invalid maxBalance")
+		}
+		f.MaxBalance = &a
+	}
+
+	return &f, nil
 }
 
 // WalletPutHandler update info of Client Subcribers/Users Wallet
@@ -149,6 +205,14 @@ func (h *AppHandler) WalletPutHandler(w http.ResponseWriter, req *http.Request)
 
 	// update wallet details based on clientID and guid
 	_, err = h.db.UpdateWalletByIDGUID(clientID, guid, &wallet)
+	if err == models.ErrWalletExists {
+		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusConflict)
+		return
+	}
+	if err == models.ErrUnknownFundType {
+		writePostingError(w, err)
+		return
+	}
 	if err != nil {
 		response.JSON(w, ErrResponse{Err: "Application Error", Message: err.Error()}, http.StatusBadRequest)
 		return
@@ -3,6 +3,8 @@ package main
 import (
 	"flag"
 	"fmt"
+	"log"
+	"time"
 
 	"github.com/avecost/ewallet"
 )
@@ -20,12 +22,32 @@ func main() {
 	dbpass := flag.String("pass", "p@ssw0rd", "database user password")
 	dbname := flag.String("db", "inventiv_raffle", "database to use")
 	dbaddr := flag.String("dbaddr", "localhost", "database address & port")
+	holdTTL := flag.Duration("holdttl", 15*time.Minute, "how long an authorized hold reserves funds")
+	quoteTTL := flag.Duration("quotettl", 30*time.Second, "how long an exchange quote locks its rate")
+	reconEvery := flag.Duration("reconevery", time.Hour, "interval of the background reconciliation, 0 disables it")
+	adminToken := flag.String("admintoken", "", "bearer token of the admin routes, empty disables them")
 	// parse the flag
 	flag.Parse()
 
 	connStr := fmt.Sprintf("postgres://%s:%s@%s/%s?sslmode=disable", *dbuser, *dbpass, *dbaddr, *dbname)
 	// create a new server
 	srvr := ewallet.NewServer(connStr)
+	srvr.HoldTTL = *holdTTL
+	srvr.QuoteTTL = *quoteTTL
+	srvr.ReconEvery = *reconEvery
+	srvr.AdminToken = *adminToken
+
+	// "reconcile" subcommand: run one reconciliation pass and exit
+	if flag.Arg(0) == "reconcile" {
+		run, err := srvr.Reconcile()
+		if err != nil {
+			log.Fatal("Reconcile Error: ", err)
+		}
+		fmt.Printf("Reconciliation run %d: %d wallets checked, %d breaks found, %d breaks cleared\n",
+			run.ID, run.WalletsChecked, run.BreaksFound, run.BreaksCleared)
+		return
+	}
+
 	// run the server
 	srvr.Run(*addr)
 }
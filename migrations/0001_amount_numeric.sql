@@ -0,0 +1,7 @@
+-- money columns are exact decimals, see models.Amount (AmountScale = 4)
+ALTER TABLE wallets
+    ALTER COLUMN balance TYPE NUMERIC(20,4) USING round(balance::numeric, 4);
+
+ALTER TABLE transactions
+    ALTER COLUMN cr_amount TYPE NUMERIC(20,4) USING round(cr_amount::numeric, 4),
+    ALTER COLUMN dr_amount TYPE NUMERIC(20,4) USING round(dr_amount::numeric, 4);
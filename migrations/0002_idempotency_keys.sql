@@ -0,0 +1,13 @@
+ALTER TABLE transactions
+    ADD COLUMN external_reference VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE INDEX transactions_external_reference_idx ON transactions (client_id, external_reference);
+
+CREATE TABLE idempotency_keys (
+    client_id       INTEGER      NOT NULL REFERENCES clients (id),
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash    CHAR(64)     NOT NULL,
+    transaction_id  INTEGER      REFERENCES transactions (id),
+    created_at      TIMESTAMP    NOT NULL,
+    PRIMARY KEY (client_id, idempotency_key)
+);
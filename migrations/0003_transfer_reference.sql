@@ -0,0 +1,4 @@
+ALTER TABLE transactions
+    ADD COLUMN transfer_reference VARCHAR(32) NOT NULL DEFAULT '';
+
+CREATE INDEX transactions_transfer_reference_idx ON transactions (transfer_reference) WHERE transfer_reference <> '';
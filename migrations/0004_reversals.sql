@@ -0,0 +1,6 @@
+ALTER TABLE transactions
+    ADD COLUMN reversal_of     VARCHAR(32)    NOT NULL DEFAULT '',
+    ADD COLUMN reversed_amount NUMERIC(20,4)  NOT NULL DEFAULT 0;
+
+CREATE UNIQUE INDEX transactions_reference_code_idx ON transactions (client_id, reference_code);
+CREATE INDEX transactions_reversal_of_idx ON transactions (reversal_of) WHERE reversal_of <> '';
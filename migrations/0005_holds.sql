@@ -0,0 +1,20 @@
+ALTER TABLE wallets
+    ADD COLUMN held_balance NUMERIC(20,4) NOT NULL DEFAULT 0;
+
+CREATE TABLE holds (
+    id              SERIAL PRIMARY KEY,
+    hold_code       VARCHAR(32)   NOT NULL UNIQUE,
+    client_id       INTEGER       NOT NULL REFERENCES clients (id),
+    address         VARCHAR(32)   NOT NULL,
+    amount          NUMERIC(20,4) NOT NULL,
+    captured_amount NUMERIC(20,4) NOT NULL DEFAULT 0,
+    method_type     VARCHAR(64)   NOT NULL DEFAULT '',
+    particulars     TEXT          NOT NULL DEFAULT '',
+    status          VARCHAR(16)   NOT NULL,
+    expires_at      TIMESTAMP     NOT NULL,
+    created_at      TIMESTAMP     NOT NULL,
+    updated_at      TIMESTAMP     NOT NULL
+);
+
+CREATE INDEX holds_wallet_idx ON holds (client_id, address);
+CREATE INDEX holds_expiry_idx ON holds (expires_at) WHERE status = 'authorized';
@@ -0,0 +1,29 @@
+ALTER TABLE transactions
+    ADD COLUMN provider_tx_id VARCHAR(128) NOT NULL DEFAULT '',
+    ADD COLUMN round_id       VARCHAR(128) NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX transactions_provider_tx_id_idx ON transactions (client_id, provider_tx_id) WHERE provider_tx_id <> '';
+CREATE INDEX transactions_round_id_idx ON transactions (client_id, round_id) WHERE round_id <> '';
+
+CREATE TABLE game_rounds (
+    client_id  INTEGER      NOT NULL REFERENCES clients (id),
+    address    VARCHAR(32)  NOT NULL,
+    round_id   VARCHAR(128) NOT NULL,
+    status     VARCHAR(16)  NOT NULL,
+    created_at TIMESTAMP    NOT NULL,
+    updated_at TIMESTAMP    NOT NULL,
+    PRIMARY KEY (client_id, round_id)
+);
+
+-- rollbacks that arrived before (or without) their bet
+CREATE TABLE seamless_tombstones (
+    client_id      INTEGER      NOT NULL REFERENCES clients (id),
+    address        VARCHAR(32)  NOT NULL,
+    provider_tx_id VARCHAR(128) NOT NULL,
+    round_id       VARCHAR(128) NOT NULL DEFAULT '',
+    rollback_tx_id VARCHAR(128) NOT NULL,
+    created_at     TIMESTAMP    NOT NULL,
+    PRIMARY KEY (client_id, provider_tx_id)
+);
+
+CREATE UNIQUE INDEX seamless_tombstones_rollback_idx ON seamless_tombstones (client_id, rollback_tx_id);
@@ -0,0 +1,26 @@
+ALTER TABLE transactions
+    ADD COLUMN old_balance NUMERIC(20,4),
+    ADD COLUMN new_balance NUMERIC(20,4);
+
+-- backfill: walk each wallet history backwards from its current balance so rows
+-- posted before this migration get the running balance they had at the time
+UPDATE transactions t
+   SET new_balance = r.new_balance,
+       old_balance = r.new_balance - (t.cr_amount - t.dr_amount)
+  FROM (SELECT h.id,
+               w.balance - (SUM(h.cr_amount - h.dr_amount) OVER (PARTITION BY h.client_id, h.address)
+                          - SUM(h.cr_amount - h.dr_amount) OVER (PARTITION BY h.client_id, h.address
+                                                                 ORDER BY h.transaction_at, h.id)) AS new_balance
+          FROM transactions h
+          JOIN wallets w ON w.client_id = h.client_id AND w.address = h.address) r
+ WHERE t.id = r.id
+   AND t.new_balance IS NULL;
+
+-- rows whose wallet no longer exists have nothing to walk back from
+UPDATE transactions SET old_balance = 0, new_balance = 0 WHERE new_balance IS NULL;
+
+ALTER TABLE transactions
+    ALTER COLUMN old_balance SET DEFAULT 0,
+    ALTER COLUMN old_balance SET NOT NULL,
+    ALTER COLUMN new_balance SET DEFAULT 0,
+    ALTER COLUMN new_balance SET NOT NULL;
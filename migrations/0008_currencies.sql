@@ -0,0 +1,26 @@
+CREATE TABLE currencies (
+    code        CHAR(3)      PRIMARY KEY,
+    name        VARCHAR(64)  NOT NULL DEFAULT '',
+    minor_units SMALLINT     NOT NULL CHECK (minor_units BETWEEN 0 AND 4),
+    rounding    VARCHAR(16)  NOT NULL DEFAULT 'half_even'
+);
+
+INSERT INTO currencies (code, name, minor_units, rounding) VALUES
+    ('PHP', 'Philippine Peso', 2, 'half_even'),
+    ('USD', 'US Dollar', 2, 'half_even'),
+    ('EUR', 'Euro', 2, 'half_even'),
+    ('JPY', 'Japanese Yen', 0, 'half_even'),
+    ('KWD', 'Kuwaiti Dinar', 3, 'half_even');
+
+-- every existing amount was implicitly in PHP
+ALTER TABLE clients
+    ADD COLUMN default_currency CHAR(3) NOT NULL DEFAULT 'PHP' REFERENCES currencies (code);
+
+ALTER TABLE wallets
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'PHP' REFERENCES currencies (code);
+
+ALTER TABLE transactions
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'PHP' REFERENCES currencies (code);
+
+ALTER TABLE holds
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'PHP' REFERENCES currencies (code);
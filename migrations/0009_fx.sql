@@ -0,0 +1,33 @@
+CREATE TABLE fx_rates (
+    id             SERIAL PRIMARY KEY,
+    base           CHAR(3)       NOT NULL REFERENCES currencies (code),
+    quote          CHAR(3)       NOT NULL REFERENCES currencies (code),
+    rate           NUMERIC(24,8) NOT NULL CHECK (rate > 0),
+    spread         NUMERIC(24,8) NOT NULL DEFAULT 0 CHECK (spread >= 0 AND spread < 1),
+    effective_from TIMESTAMP     NOT NULL,
+    created_at     TIMESTAMP     NOT NULL
+);
+
+CREATE INDEX fx_rates_pair_idx ON fx_rates (base, quote, effective_from DESC);
+
+CREATE TABLE fx_quotes (
+    quote_code           VARCHAR(32)   PRIMARY KEY,
+    client_id            INTEGER       NOT NULL REFERENCES clients (id),
+    source               VARCHAR(32)   NOT NULL,
+    destination          VARCHAR(32)   NOT NULL,
+    source_currency      CHAR(3)       NOT NULL,
+    destination_currency CHAR(3)       NOT NULL,
+    source_amount        NUMERIC(20,4) NOT NULL,
+    destination_amount   NUMERIC(20,4) NOT NULL,
+    rate                 NUMERIC(24,8) NOT NULL,
+    spread               NUMERIC(24,8) NOT NULL,
+    applied_rate         NUMERIC(24,8) NOT NULL,
+    method_type          VARCHAR(64)   NOT NULL DEFAULT '',
+    particulars          TEXT          NOT NULL DEFAULT '',
+    status               VARCHAR(16)   NOT NULL,
+    expires_at           TIMESTAMP     NOT NULL,
+    created_at           TIMESTAMP     NOT NULL
+);
+
+ALTER TABLE transactions
+    ADD COLUMN fx_rate NUMERIC(24,8) NOT NULL DEFAULT 0;
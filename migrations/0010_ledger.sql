@@ -0,0 +1,69 @@
+CREATE TABLE accounts (
+    id         SERIAL PRIMARY KEY,
+    client_id  INTEGER     NOT NULL REFERENCES clients (id),
+    code       VARCHAR(64) NOT NULL,
+    kind       VARCHAR(16) NOT NULL,
+    address    VARCHAR(32) NOT NULL DEFAULT '',
+    currency   CHAR(3)     NOT NULL REFERENCES currencies (code),
+    created_at TIMESTAMP   NOT NULL,
+    UNIQUE (client_id, code, currency)
+);
+
+CREATE TABLE journal_entries (
+    id             SERIAL PRIMARY KEY,
+    client_id      INTEGER     NOT NULL REFERENCES clients (id),
+    transaction_id INTEGER     REFERENCES transactions (id),
+    reference_code VARCHAR(64) NOT NULL DEFAULT '',
+    description    TEXT        NOT NULL DEFAULT '',
+    created_at     TIMESTAMP   NOT NULL
+);
+
+CREATE INDEX journal_entries_transaction_idx ON journal_entries (transaction_id);
+
+CREATE TABLE postings (
+    id               SERIAL PRIMARY KEY,
+    journal_entry_id INTEGER       NOT NULL REFERENCES journal_entries (id),
+    account_id       INTEGER       NOT NULL REFERENCES accounts (id),
+    currency         CHAR(3)       NOT NULL,
+    amount           NUMERIC(20,4) NOT NULL
+);
+
+CREATE INDEX postings_account_idx ON postings (account_id);
+CREATE INDEX postings_entry_idx ON postings (journal_entry_id);
+
+-- the postings of an entry must sum to zero per currency, checked at commit
+CREATE FUNCTION check_journal_balanced() RETURNS trigger AS $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM postings WHERE journal_entry_id = NEW.journal_entry_id
+               GROUP BY currency HAVING SUM(amount) <> 0) THEN
+        RAISE EXCEPTION 'journal entry % does not balance', NEW.journal_entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced AFTER INSERT ON postings
+    DEFERRABLE INITIALLY DEFERRED FOR EACH ROW EXECUTE PROCEDURE check_journal_balanced();
+
+-- open the ledger with the current wallet balances against the client float
+INSERT INTO accounts (client_id, code, kind, address, currency, created_at)
+SELECT client_id, 'wallet:' || address, 'wallet', address, currency, now() FROM wallets;
+
+INSERT INTO accounts (client_id, code, kind, address, currency, created_at)
+SELECT DISTINCT client_id, 'client_float', 'system', '', currency, now() FROM wallets;
+
+INSERT INTO journal_entries (client_id, reference_code, description, created_at)
+SELECT client_id, address, 'ledger opening balance', now() FROM wallets WHERE balance <> 0;
+
+INSERT INTO postings (journal_entry_id, account_id, currency, amount)
+SELECT j.id, a.id, w.currency, w.balance
+FROM journal_entries j
+JOIN wallets w ON w.client_id = j.client_id AND w.address = j.reference_code
+JOIN accounts a ON a.client_id = w.client_id AND a.code = 'wallet:' || w.address AND a.currency = w.currency
+WHERE j.description = 'ledger opening balance'
+UNION ALL
+SELECT j.id, a.id, w.currency, -w.balance
+FROM journal_entries j
+JOIN wallets w ON w.client_id = j.client_id AND w.address = j.reference_code
+JOIN accounts a ON a.client_id = w.client_id AND a.code = 'client_float' AND a.currency = w.currency
+WHERE j.description = 'ledger opening balance';
@@ -0,0 +1,21 @@
+-- NULL means no limit, the wallet scope overrides fund_type which overrides client
+CREATE TABLE limits (
+    id            SERIAL PRIMARY KEY,
+    client_id     INTEGER       NOT NULL REFERENCES clients (id),
+    scope         VARCHAR(16)   NOT NULL CHECK (scope IN ('client', 'fund_type', 'wallet')),
+    scope_value   VARCHAR(64)   NOT NULL DEFAULT '',
+    max_balance   NUMERIC(20,4),
+    max_credit    NUMERIC(20,4),
+    max_debit     NUMERIC(20,4),
+    daily_debit   NUMERIC(20,4),
+    weekly_debit  NUMERIC(20,4),
+    monthly_debit NUMERIC(20,4),
+    daily_count   INTEGER,
+    weekly_count  INTEGER,
+    monthly_count INTEGER,
+    created_at    TIMESTAMP     NOT NULL,
+    updated_at    TIMESTAMP     NOT NULL,
+    UNIQUE (client_id, scope, scope_value)
+);
+
+CREATE INDEX transactions_wallet_at_idx ON transactions (client_id, address, transaction_at);
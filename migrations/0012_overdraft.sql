@@ -0,0 +1,9 @@
+-- balance may go down to -credit_limit, overdraft_used is the drawn part not repaid yet
+ALTER TABLE wallets
+    ADD COLUMN credit_limit    NUMERIC(20,4) NOT NULL DEFAULT 0 CHECK (credit_limit >= 0),
+    ADD COLUMN overdraft_used  NUMERIC(20,4) NOT NULL DEFAULT 0 CHECK (overdraft_used >= 0),
+    ADD COLUMN overdraft_first BOOLEAN       NOT NULL DEFAULT FALSE;
+
+UPDATE wallets SET overdraft_used = -balance WHERE balance < 0;
+
+CREATE INDEX wallets_overdraft_idx ON wallets (client_id) WHERE overdraft_used > 0 OR balance < 0;
@@ -0,0 +1,26 @@
+CREATE TABLE recon_runs (
+    id              SERIAL PRIMARY KEY,
+    wallets_checked INTEGER   NOT NULL DEFAULT 0,
+    breaks_found    INTEGER   NOT NULL DEFAULT 0,
+    breaks_cleared  INTEGER   NOT NULL DEFAULT 0,
+    started_at      TIMESTAMP NOT NULL,
+    finished_at     TIMESTAMP
+);
+
+CREATE TABLE recon_breaks (
+    id               SERIAL PRIMARY KEY,
+    run_id           INTEGER       NOT NULL REFERENCES recon_runs (id),
+    client_id        INTEGER       NOT NULL REFERENCES clients (id),
+    address          VARCHAR(32)   NOT NULL,
+    currency         CHAR(3)       NOT NULL,
+    stored_balance   NUMERIC(20,4) NOT NULL,
+    expected_balance NUMERIC(20,4) NOT NULL,
+    difference       NUMERIC(20,4) NOT NULL,
+    status           VARCHAR(16)   NOT NULL,
+    note             TEXT          NOT NULL DEFAULT '',
+    created_at       TIMESTAMP     NOT NULL,
+    resolved_at      TIMESTAMP
+);
+
+-- one open break per wallet, each run refreshes it
+CREATE UNIQUE INDEX recon_breaks_open_idx ON recon_breaks (client_id, address) WHERE status = 'open';
@@ -0,0 +1,3 @@
+-- keyset pagination walks (transaction_at, id) within a wallet
+DROP INDEX IF EXISTS transactions_wallet_at_idx;
+CREATE INDEX transactions_wallet_at_idx ON transactions (client_id, address, transaction_at, id);
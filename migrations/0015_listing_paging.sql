@@ -0,0 +1,3 @@
+-- keyset pagination walks (created_at, id)
+CREATE INDEX wallets_client_created_idx ON wallets (client_id, created_at, id);
+CREATE INDEX clients_created_idx ON clients (created_at, id);
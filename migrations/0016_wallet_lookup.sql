@@ -0,0 +1,4 @@
+ALTER TABLE clients
+    ADD COLUMN unique_fund_type BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX wallets_user_idx ON wallets (client_id, user_id, fund_type);
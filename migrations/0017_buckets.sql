@@ -0,0 +1,18 @@
+-- a wallet balance is split in buckets, debits draw from them in bucket_precedence order
+ALTER TABLE wallets
+    ADD COLUMN bucket_precedence TEXT NOT NULL DEFAULT 'cash,bonus,promo';
+
+CREATE TABLE wallet_buckets (
+    client_id INTEGER       NOT NULL,
+    address   TEXT          NOT NULL,
+    bucket    TEXT          NOT NULL CHECK (bucket IN ('cash', 'bonus', 'promo')),
+    balance   NUMERIC(20,4) NOT NULL DEFAULT 0,
+    PRIMARY KEY (client_id, address, bucket)
+);
+
+-- everything held before buckets is cash
+INSERT INTO wallet_buckets (client_id, address, bucket, balance)
+SELECT client_id, address, 'cash', balance FROM wallets;
+
+ALTER TABLE transactions
+    ADD COLUMN buckets JSONB NOT NULL DEFAULT '[]';
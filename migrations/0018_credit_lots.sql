@@ -0,0 +1,17 @@
+-- an expiring credit opens a lot, debits use up the lots soonest expiry first
+CREATE TABLE credit_lots (
+    id             SERIAL PRIMARY KEY,
+    client_id      INTEGER       NOT NULL,
+    address        TEXT          NOT NULL,
+    reference_code TEXT          NOT NULL,
+    bucket         TEXT          NOT NULL,
+    amount         NUMERIC(20,4) NOT NULL CHECK (amount > 0),
+    remaining      NUMERIC(20,4) NOT NULL CHECK (remaining >= 0),
+    expires_at     TIMESTAMP     NOT NULL,
+    status         TEXT          NOT NULL DEFAULT 'open',
+    created_at     TIMESTAMP     NOT NULL,
+    expired_at     TIMESTAMP
+);
+
+CREATE INDEX credit_lots_wallet_idx ON credit_lots (client_id, address, bucket, expires_at) WHERE status = 'open';
+CREATE INDEX credit_lots_due_idx ON credit_lots (expires_at) WHERE status = 'open';
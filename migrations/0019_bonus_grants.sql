@@ -0,0 +1,20 @@
+-- bonus money waits in the bonus bucket until its wagering is met or it expires
+CREATE TABLE bonus_grants (
+    id                SERIAL PRIMARY KEY,
+    client_id         INTEGER       NOT NULL,
+    address           TEXT          NOT NULL,
+    reference_code    TEXT          NOT NULL,
+    amount            NUMERIC(20,4) NOT NULL CHECK (amount > 0),
+    multiplier        INTEGER       NOT NULL CHECK (multiplier >= 1),
+    status            TEXT          NOT NULL DEFAULT 'active',
+    expires_at        TIMESTAMP,
+    created_at        TIMESTAMP     NOT NULL,
+    settled_at        TIMESTAMP,
+    settled_amount    NUMERIC(20,4) NOT NULL DEFAULT 0,
+    wagering_required NUMERIC(20,4) NOT NULL,
+    wagered           NUMERIC(20,4) NOT NULL DEFAULT 0,
+    UNIQUE (client_id, reference_code)
+);
+
+CREATE INDEX bonus_grants_wallet_idx ON bonus_grants (client_id, address) WHERE status = 'active';
+CREATE INDEX bonus_grants_due_idx ON bonus_grants (expires_at) WHERE status = 'active';
@@ -0,0 +1,21 @@
+-- fees charged per client, method type and cr/dr, collected in the fees ledger account
+CREATE TABLE fee_schedules (
+    id               SERIAL PRIMARY KEY,
+    client_id        INTEGER       NOT NULL,
+    method_type      TEXT          NOT NULL,
+    transaction_type TEXT          NOT NULL CHECK (transaction_type IN ('cr', 'dr')),
+    flat             NUMERIC(20,4) NOT NULL DEFAULT 0,
+    percent          NUMERIC(20,8) NOT NULL DEFAULT 0,
+    tiers            JSONB         NOT NULL DEFAULT '[]',
+    min_fee          NUMERIC(20,4),
+    max_fee          NUMERIC(20,4),
+    netted           BOOLEAN       NOT NULL DEFAULT FALSE,
+    created_at       TIMESTAMP     NOT NULL,
+    updated_at       TIMESTAMP     NOT NULL,
+    UNIQUE (client_id, method_type, transaction_type)
+);
+
+-- fee is the breakdown of the fee charged on the row, fee_of links a fee dr to the row it charges for
+ALTER TABLE transactions
+    ADD COLUMN fee    JSONB,
+    ADD COLUMN fee_of TEXT NOT NULL DEFAULT '';
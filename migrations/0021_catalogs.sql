@@ -0,0 +1,19 @@
+-- allowed method and fund types per client, a client with an empty catalog accepts any value
+CREATE TABLE method_types (
+    client_id  INTEGER   NOT NULL,
+    code       TEXT      NOT NULL,
+    name       TEXT      NOT NULL DEFAULT '',
+    direction  TEXT      NOT NULL CHECK (direction IN ('credit', 'debit', 'both')),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (client_id, code)
+);
+
+CREATE TABLE fund_types (
+    client_id  INTEGER   NOT NULL,
+    code       TEXT      NOT NULL,
+    name       TEXT      NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (client_id, code)
+);
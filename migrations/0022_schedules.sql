@@ -0,0 +1,40 @@
+-- recurring cr/dr of an e-Wallet, every is a Go duration like '24h' when cron is empty
+CREATE TABLE schedules (
+    id               SERIAL PRIMARY KEY,
+    client_id        INTEGER       NOT NULL,
+    address          TEXT          NOT NULL,
+    transaction_type TEXT          NOT NULL CHECK (transaction_type IN ('cr', 'dr')),
+    amount           NUMERIC(20,4) NOT NULL CHECK (amount > 0),
+    method_type      TEXT          NOT NULL,
+    particulars      TEXT          NOT NULL DEFAULT '',
+    cron             TEXT          NOT NULL DEFAULT '',
+    every            TEXT          NOT NULL DEFAULT '',
+    start_at         TIMESTAMP,
+    ends_at          TIMESTAMP,
+    max_retries      INTEGER       NOT NULL DEFAULT 3,
+    retry_every      TEXT          NOT NULL DEFAULT '1h0m0s',
+    status           TEXT          NOT NULL DEFAULT 'active',
+    next_run_at      TIMESTAMP,
+    retry_at         TIMESTAMP,
+    attempts         INTEGER       NOT NULL DEFAULT 0,
+    created_at       TIMESTAMP     NOT NULL,
+    updated_at       TIMESTAMP     NOT NULL
+);
+
+CREATE INDEX schedules_due_idx ON schedules (COALESCE(retry_at, next_run_at)) WHERE status = 'active';
+CREATE INDEX schedules_wallet_idx ON schedules (client_id, address);
+
+-- one row per attempt, an occurrence is posted at most once
+CREATE TABLE schedule_runs (
+    id             SERIAL PRIMARY KEY,
+    schedule_id    INTEGER   NOT NULL REFERENCES schedules (id),
+    due_at         TIMESTAMP NOT NULL,
+    attempt        INTEGER   NOT NULL,
+    status         TEXT      NOT NULL,
+    reference_code TEXT      NOT NULL DEFAULT '',
+    error          TEXT      NOT NULL DEFAULT '',
+    run_at         TIMESTAMP NOT NULL,
+    UNIQUE (schedule_id, due_at, attempt)
+);
+
+CREATE UNIQUE INDEX schedule_runs_posted_idx ON schedule_runs (schedule_id, due_at) WHERE status = 'posted';
@@ -0,0 +1,4 @@
+-- what is left of each grant in the bonus bucket, only that is converted or forfeited
+ALTER TABLE bonus_grants ADD COLUMN remaining NUMERIC(20,4) NOT NULL DEFAULT 0;
+
+UPDATE bonus_grants SET remaining = amount WHERE status = 'active';
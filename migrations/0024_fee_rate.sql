@@ -0,0 +1,7 @@
+-- the fee percent is a fraction of the amount, name it rate in the column and the stored tiers
+ALTER TABLE fee_schedules RENAME COLUMN percent TO rate;
+
+UPDATE fee_schedules SET tiers = (
+    SELECT COALESCE(jsonb_agg((t - 'percent') || jsonb_build_object('rate', t->'percent') ORDER BY i), '[]')
+    FROM jsonb_array_elements(tiers) WITH ORDINALITY AS e(t, i)
+) WHERE jsonb_array_length(tiers) > 0;
@@ -0,0 +1,271 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// AmountScale is the number of decimal places kept by an Amount
+const AmountScale = 4
+
+// amountUnit is the number of Amount units in 1.0
+const amountUnit = 10000
+
+// Amount is an exact money value counted in 1/10^AmountScale units,
+// it is stored in NUMERIC(20,4) columns and never goes through float64
+type Amount int64
+
+// RoundingMode tells how digits beyond the kept decimal places are dropped
+type RoundingMode int
+
+const (
+	// RoundHalfEven round to nearest, ties go to the even digit (banker's rounding)
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp round to nearest, ties go away from zero
+	RoundHalfUp
+	// RoundDown drop the extra digits (toward zero)
+	RoundDown
+	// RoundUp round away from zero when any extra digit is not zero
+	RoundUp
+)
+
+// DefaultRounding is used when an input has more decimals than AmountScale
+var DefaultRounding = RoundHalfEven
+
+// ErrInvalidAmount is returned when a value can not be read as an Amount
+var ErrInvalidAmount = errors.New("Invalid amount")
+
+// ParseAmount read a decimal string like "12.5", "-0.10" or "1e3",
+// extra decimals are rounded with DefaultRounding
+func ParseAmount(s string) (Amount, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return 0, ErrInvalidAmount
+	}
+
+	return amountFromRat(r, DefaultRounding)
+}
+
+// MustParseAmount is like ParseAmount but panics on error, for constants only
+func MustParseAmount(s string) Amount {
+	a, err := ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return a
+}
+
+// amountFromRat convert r to an Amount rounding with mode
+func amountFromRat(r *big.Rat, mode RoundingMode) (Amount, error) {
+	v, err := fixedFromRat(r, amountUnit, mode)
+
+	return Amount(v), err
+}
+
+// fixedFromRat convert r to a count of 1/unit rounding with mode
+func fixedFromRat(r *big.Rat, unit int64, mode RoundingMode) (int64, error) {
+	n := new(big.Int).Mul(r.Num(), big.NewInt(unit))
+	q, m := new(big.Int).QuoRem(n, r.Denom(), new(big.Int))
+	if m.Sign() != 0 {
+		// compare twice the remainder with the denominator to find ties
+		c := new(big.Int).Abs(m)
+		c.Lsh(c, 1)
+		if roundAway(mode, c.Cmp(r.Denom()), q.Bit(0) == 1) {
+			q.Add(q, big.NewInt(int64(n.Sign())))
+		}
+	}
+	if !q.IsInt64() {
+		return 0, ErrInvalidAmount
+	}
+
+	return q.Int64(), nil
+}
+
+// roundAway decide if the truncated value moves one unit away from zero,
+// half is the comparison of the dropped part against one half
+func roundAway(mode RoundingMode, half int, odd bool) bool {
+	switch mode {
+	case RoundHalfUp:
+		return half >= 0
+	case RoundDown:
+		return false
+	case RoundUp:
+		return true
+	}
+	// RoundHalfEven
+	return half > 0 || (half == 0 && odd)
+}
+
+// Round drop the digits beyond places decimals using mode
+func (a Amount) Round(places int, mode RoundingMode) Amount {
+	if places >= AmountScale {
+		return a
+	}
+	unit := Amount(1)
+	for i := places; i < AmountScale; i++ {
+		unit *= 10
+	}
+	q, m := a/unit, a%unit
+	if m == 0 {
+		return a
+	}
+	if m < 0 {
+		m = -m
+	}
+	half := 0
+	switch {
+	case 2*m > unit:
+		half = 1
+	case 2*m < unit:
+		half = -1
+	}
+	if roundAway(mode, half, q%2 != 0) {
+		if a < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+
+	return q * unit
+}
+
+// String return the amount with all AmountScale decimals, e.g. "12.5000"
+func (a Amount) String() string {
+	return formatFixed(int64(a), amountUnit, AmountScale)
+}
+
+// formatFixed write a count of 1/unit with scale decimals
+func formatFixed(v, unit int64, scale int) string {
+	sign := ""
+	u := uint64(v)
+	if v < 0 {
+		sign = "-"
+		u = uint64(-v)
+	}
+
+	return fmt.Sprintf("%s%d.%0*d", sign, u/uint64(unit), scale, u%uint64(unit))
+}
+
+// Mul return a times r rounded to the Amount scale with mode, ErrInvalidAmount when it overflows
+func (a Amount) Mul(r Rate, mode RoundingMode) (Amount, error) {
+	p := new(big.Rat).SetFrac(big.NewInt(int64(a)), big.NewInt(amountUnit))
+	p.Mul(p, r.rat())
+
+	return amountFromRat(p, mode)
+}
+
+// MarshalJSON emit the amount as an exact JSON number
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accept the amount as a JSON number or a string
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if uq, err := strconv.Unquote(s); err == nil {
+		s = uq
+	}
+	v, err := ParseAmount(s)
+	if err != nil {
+		return fmt.Errorf("Invalid amount %s", b)
+	}
+	*a = v
+
+	return nil
+}
+
+// Scan read a NUMERIC column
+func (a *Amount) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+	case []byte:
+		*a, err = ParseAmount(string(v))
+	case string:
+		*a, err = ParseAmount(v)
+	case int64:
+		if v > math.MaxInt64/amountUnit || v < math.MinInt64/amountUnit {
+			return ErrInvalidAmount
+		}
+		*a = Amount(v * amountUnit)
+	case float64:
+		*a, err = ParseAmount(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		err = fmt.Errorf("Cannot scan %T into Amount", src)
+	}
+
+	return err
+}
+
+// Value write the amount as an exact decimal string for NUMERIC columns
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// roundingNames is the text form of each RoundingMode, used in JSON and the currencies table
+var roundingNames = map[RoundingMode]string{
+	RoundHalfEven: "half_even",
+	RoundHalfUp:   "half_up",
+	RoundDown:     "down",
+	RoundUp:       "up",
+}
+
+// String return the text form of the rounding mode
+func (m RoundingMode) String() string {
+	return roundingNames[m]
+}
+
+// ParseRoundingMode read the text form of a rounding mode
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	for m, name := range roundingNames {
+		if name == s {
+			return m, nil
+		}
+	}
+
+	return 0, fmt.Errorf("Invalid rounding mode %q", s)
+}
+
+// MarshalText emit the rounding mode name
+func (m RoundingMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText read the rounding mode name
+func (m *RoundingMode) UnmarshalText(b []byte) error {
+	v, err := ParseRoundingMode(string(b))
+	if err != nil {
+		return err
+	}
+	*m = v
+
+	return nil
+}
+
+// Scan read the rounding mode name from a text column
+func (m *RoundingMode) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return m.UnmarshalText(v)
+	case string:
+		return m.UnmarshalText([]byte(v))
+	}
+
+	return fmt.Errorf("Cannot scan %T into RoundingMode", src)
+}
+
+// Value write the rounding mode name
+func (m RoundingMode) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,255 @@
+package models
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		err  bool
+	}{
+		{in: "12.5", want: 125000},
+		{in: "-0.10", want: -1000},
+		{in: "1e3", want: 10000000},
+		{in: " 7 ", want: 70000},
+		{in: "0.0001", want: 1},
+		// extra decimals are rounded half even
+		{in: "0.00005", want: 0},
+		{in: "0.00015", want: 2},
+		{in: "-0.00015", want: -2},
+		{in: "", err: true},
+		{in: "abc", err: true},
+		{in: "1.2.3", err: true},
+		{in: "1e30", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.in)
+		if tt.err {
+			if err != ErrInvalidAmount {
+				t.Errorf("ParseAmount(%q) error = %v, want ErrInvalidAmount", tt.in, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseAmount(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestAmountFromRatRounding(t *testing.T) {
+	tests := []struct {
+		in   string
+		mode RoundingMode
+		want Amount
+	}{
+		{"0.00015", RoundHalfEven, 2},
+		{"0.00015", RoundHalfUp, 2},
+		{"0.00015", RoundDown, 1},
+		{"0.00015", RoundUp, 2},
+		{"0.00025", RoundHalfEven, 2},
+		{"0.00025", RoundHalfUp, 3},
+		{"0.00025", RoundDown, 2},
+		{"0.00025", RoundUp, 3},
+		{"-0.00025", RoundHalfEven, -2},
+		{"-0.00025", RoundHalfUp, -3},
+		{"-0.00025", RoundDown, -2},
+		{"-0.00025", RoundUp, -3},
+		{"0.00011", RoundHalfEven, 1},
+		{"0.00011", RoundUp, 2},
+		{"0.00019", RoundHalfEven, 2},
+		{"0.00019", RoundDown, 1},
+		{"1.5", RoundDown, 15000},
+	}
+
+	for _, tt := range tests {
+		r, _ := new(big.Rat).SetString(tt.in)
+		got, err := amountFromRat(r, tt.mode)
+		if err != nil || got != tt.want {
+			t.Errorf("amountFromRat(%s, %s) = %d, %v, want %d", tt.in, tt.mode, got, err, tt.want)
+		}
+	}
+}
+
+func TestAmountRound(t *testing.T) {
+	tests := []struct {
+		in     string
+		places int
+		mode   RoundingMode
+		want   string
+	}{
+		{"1.2350", 2, RoundHalfEven, "1.2400"},
+		{"1.2250", 2, RoundHalfEven, "1.2200"},
+		{"1.2250", 2, RoundHalfUp, "1.2300"},
+		{"1.2299", 2, RoundDown, "1.2200"},
+		{"1.2201", 2, RoundUp, "1.2300"},
+		{"-1.2250", 2, RoundHalfEven, "-1.2200"},
+		{"-1.2250", 2, RoundHalfUp, "-1.2300"},
+		{"-1.2299", 2, RoundDown, "-1.2200"},
+		{"-1.2201", 2, RoundUp, "-1.2300"},
+		{"2.5", 0, RoundHalfEven, "2.0000"},
+		{"3.5", 0, RoundHalfEven, "4.0000"},
+		{"1.2000", 2, RoundUp, "1.2000"},
+		{"1.2345", 4, RoundDown, "1.2345"},
+		{"1.2345", 6, RoundDown, "1.2345"},
+	}
+
+	for _, tt := range tests {
+		got := MustParseAmount(tt.in).Round(tt.places, tt.mode).String()
+		if got != tt.want {
+			t.Errorf("%s.Round(%d, %s) = %s, want %s", tt.in, tt.places, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestAmountString(t *testing.T) {
+	tests := []struct {
+		in   Amount
+		want string
+	}{
+		{0, "0.0000"},
+		{125000, "12.5000"},
+		{-1000, "-0.1000"},
+		{-5, "-0.0005"},
+		{1, "0.0001"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Amount(%d).String() = %s, want %s", int64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestAmountUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		err  bool
+	}{
+		{in: `12.34`, want: 123400},
+		{in: `"12.34"`, want: 123400},
+		{in: `null`, want: 0},
+		{in: `"x"`, err: true},
+		{in: `true`, err: true},
+	}
+
+	for _, tt := range tests {
+		var got Amount
+		err := got.UnmarshalJSON([]byte(tt.in))
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("UnmarshalJSON(%s) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestAmountScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Amount
+		err  bool
+	}{
+		{src: nil, want: 0},
+		{src: []byte("12.3400"), want: 123400},
+		{src: "-0.5", want: -5000},
+		{src: int64(5), want: 50000},
+		{src: int64(-5), want: -50000},
+		{src: int64(math.MaxInt64 / amountUnit), want: Amount(math.MaxInt64 / amountUnit * amountUnit)},
+		{src: int64(math.MaxInt64/amountUnit + 1), err: true},
+		{src: int64(math.MinInt64/amountUnit - 1), err: true},
+		{src: int64(math.MaxInt64), err: true},
+		{src: 0.1, want: 1000},
+		{src: true, err: true},
+	}
+
+	for _, tt := range tests {
+		var got Amount
+		err := got.Scan(tt.src)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Scan(%v) = %d, want an error", tt.src, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Scan(%v) = %d, %v, want %d", tt.src, got, err, tt.want)
+		}
+	}
+}
+
+func TestAmountMul(t *testing.T) {
+	tests := []struct {
+		a    string
+		r    string
+		mode RoundingMode
+		want string
+	}{
+		{"100", "1.5", RoundHalfEven, "150.0000"},
+		{"0.0001", "0.5", RoundHalfEven, "0.0000"},
+		{"0.0001", "0.5", RoundHalfUp, "0.0001"},
+		{"0.0003", "0.5", RoundHalfEven, "0.0002"},
+		{"-10", "0.33333333", RoundDown, "-3.3333"},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRate(tt.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := MustParseAmount(tt.a).Mul(r, tt.mode)
+		if err != nil || got.String() != tt.want {
+			t.Errorf("%s.Mul(%s, %s) = %s, %v, want %s", tt.a, tt.r, tt.mode, got, err, tt.want)
+		}
+	}
+
+	if got, err := Amount(math.MaxInt64).Mul(mustParseRate(t, "2"), RoundHalfEven); err != ErrInvalidAmount {
+		t.Errorf("overflowing Mul = %s, %v, want ErrInvalidAmount", got, err)
+	}
+}
+
+func TestCurrencyMul(t *testing.T) {
+	php := &Currency{Code: "PHP", MinorUnits: 2, Rounding: RoundHalfEven}
+	jpy := &Currency{Code: "JPY", MinorUnits: 0, Rounding: RoundHalfUp}
+	tests := []struct {
+		c    *Currency
+		a    string
+		r    string
+		want string
+		err  bool
+	}{
+		{c: php, a: "100", r: "0.015", want: "1.5000"},
+		{c: php, a: "1", r: "0.0125", want: "0.0100"},
+		{c: php, a: "1", r: "0.0135", want: "0.0100"},
+		{c: jpy, a: "10", r: "0.25", want: "3.0000"},
+		{c: jpy, a: "922337203685477", r: "2", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.c.Mul(MustParseAmount(tt.a), mustParseRate(t, tt.r))
+		if tt.err {
+			if err != ErrInvalidAmount {
+				t.Errorf("%s Mul(%s, %s) = %s, %v, want ErrInvalidAmount", tt.c.Code, tt.a, tt.r, got, err)
+			}
+			continue
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("%s Mul(%s, %s) = %s, %v, want %s", tt.c.Code, tt.a, tt.r, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseRoundingMode(t *testing.T) {
+	for _, m := range []RoundingMode{RoundHalfEven, RoundHalfUp, RoundDown, RoundUp} {
+		got, err := ParseRoundingMode(m.String())
+		if err != nil || got != m {
+			t.Errorf("ParseRoundingMode(%q) = %v, %v, want %v", m.String(), got, err, m)
+		}
+	}
+	if _, err := ParseRoundingMode("nearest"); err == nil {
+		t.Error("ParseRoundingMode(\"nearest\") want an error")
+	}
+}
@@ -0,0 +1,421 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	// ErrInvalidBonus is returned for a bonus grant without an amount or a wagering multiplier
+	ErrInvalidBonus = errors.New("Bonus needs an amount and a wagering multiplier of at least 1")
+	// ErrBonusLocked is returned for a debit or transfer given a breakdown that draws on bonus
+	// money still being wagered
+	ErrBonusLocked = errors.New("Bonus money can only be wagered until its wagering is met")
+)
+
+// bonus grant statuses
+const (
+	BonusActive    = "active"
+	BonusConverted = "converted"
+	BonusForfeited = "forfeited"
+)
+
+// method types of the postings made for bonus grants, none of them counts as wagering
+const (
+	MethodBonus           = "bonus"
+	MethodBonusConversion = "bonus_conversion"
+	MethodBonusForfeit    = "bonus_forfeit"
+)
+
+// BonusGrant is bonus money credited to the bonus bucket. It turns into cash once the bets
+// of the e-Wallet reach Multiplier times the Amount, or is forfeited at ExpiresAt. Until then
+// the bonus bucket only stakes bets, plain debits and transfers can not spend it.
+type BonusGrant struct {
+	ID            int        `json:"id"`
+	ClientID      int        `json:"clientId"`
+	Address       string     `json:"address"`
+	ReferenceCode string     `json:"referenceCode"`
+	Amount        Amount     `json:"amount"`
+	Multiplier    int        `json:"multiplier"`
+	Status        string     `json:"status"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	SettledAt     *time.Time `json:"settledAt,omitempty"`
+	// Remaining is the grant money still in the bonus bucket, SettledAmount what was
+	// converted to cash or forfeited
+	Remaining     Amount `json:"remaining"`
+	SettledAmount Amount `json:"settledAmount"`
+
+	// WageringRequired is Multiplier times Amount, Wagered the bets counted so far
+	WageringRequired Amount `json:"wageringRequired"`
+	Wagered          Amount `json:"wagered"`
+	WageringLeft     Amount `json:"wageringLeft"`
+
+	// Particulars and ExternalReference are copied to the bonus credit
+	Particulars       string `json:"particulars,omitempty"`
+	ExternalReference string `json:"externalReference,omitempty"`
+}
+
+// bonusGrantColumns is the select list read by scanBonusGrant
+const bonusGrantColumns = "id, client_id, address, reference_code, amount, multiplier, status, expires_at, " +
+	" created_at, settled_at, remaining, settled_amount, wagering_required, wagered"
+
+func scanBonusGrant(r rowScanner, g *BonusGrant) error {
+	err := r.Scan(&g.ID, &g.ClientID, &g.Address, &g.ReferenceCode, &g.Amount, &g.Multiplier, &g.Status, &g.ExpiresAt,
+		&g.CreatedAt, &g.SettledAt, &g.Remaining, &g.SettledAmount, &g.WageringRequired, &g.Wagered)
+	if err != nil {
+		return err
+	}
+	g.WageringLeft = 0
+	if g.Status == BonusActive && g.Wagered < g.WageringRequired {
+		g.WageringLeft = g.WageringRequired - g.Wagered
+	}
+
+	return nil
+}
+
+// GrantBonus credit the bonus to the bonus bucket of the e-Wallet and start tracking its wagering,
+// idemKey works as in PostCreditTransaction
+func (db *DB) GrantBonus(g *BonusGrant, idemKey string) (*BonusGrant, error) {
+	if g.Amount <= 0 || g.Multiplier < 1 {
+		return nil, ErrInvalidBonus
+	}
+	if g.ExpiresAt != nil && !g.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+	if err := checkClientKey(idemKey); err != nil {
+		return nil, err
+	}
+
+	credit := Transaction{
+		ClientID:          g.ClientID,
+		Address:           g.Address,
+		TransactionType:   "cr",
+		CrAmount:          g.Amount,
+		MethodType:        MethodBonus,
+		Particulars:       g.Particulars,
+		ExternalReference: g.ExternalReference,
+		Bucket:            BucketBonus,
+	}
+	// a replay must also ask for the same wagering and expiry
+	credit.grantTerms = fmt.Sprintf("%d", g.Multiplier)
+	if g.ExpiresAt != nil {
+		credit.grantTerms += "|" + g.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+	err := db.withTx(func(tx *sql.Tx) error {
+		replay, err := claimIdempotencyKey(tx, &credit, idemKey)
+		if err != nil {
+			return err
+		}
+		if replay != nil {
+			return scanBonusGrant(tx.QueryRow("SELECT "+bonusGrantColumns+" FROM bonus_grants "+
+				" WHERE client_id = $1 AND reference_code = $2", replay.ClientID, replay.ReferenceCode), g)
+		}
+		if err = lockWallet(tx, credit.ClientID, credit.Address); err != nil {
+			return err
+		}
+		if err = postTransaction(tx, &credit); err != nil {
+			return err
+		}
+
+		err = scanBonusGrant(tx.QueryRow("INSERT INTO bonus_grants (client_id, address, reference_code, amount, "+
+			" remaining, multiplier, status, expires_at, created_at, wagering_required) "+
+			" VALUES ($1, $2, $3, $4, $4, $5, $6, $7, $8, $9) RETURNING "+bonusGrantColumns,
+			g.ClientID, g.Address, credit.ReferenceCode, g.Amount, g.Multiplier, BonusActive, g.ExpiresAt,
+			credit.TransactionAt, g.Amount*Amount(g.Multiplier)), g)
+		if err != nil {
+			return err
+		}
+
+		return saveIdempotencyKey(tx, &credit, idemKey)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// GetAllBonusGrant return the bonus grants of the e-Wallet with their wagering progress, newest first
+func (db *DB) GetAllBonusGrant(id int, guid string) ([]BonusGrant, error) {
+	rows, err := db.Query("SELECT "+bonusGrantColumns+" FROM bonus_grants WHERE client_id = $1 AND address = $2 "+
+		" ORDER BY id DESC", id, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []BonusGrant
+	for rows.Next() {
+		var g BonusGrant
+		err := scanBonusGrant(rows, &g)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		grants = append(grants, g)
+	}
+
+	return grants, nil
+}
+
+// applyWagering count a bet towards the active grants of the e-Wallet, oldest grant first,
+// and convert the grants it completes. The reversal of a counted bet takes the amount back
+// from the oldest active grant. The caller must hold the Wallet row lock.
+func applyWagering(tx *sql.Tx, t *Transaction) error {
+	if t.TransactionType == "cr" {
+		if t.ReversalOf == "" {
+			return nil
+		}
+		var method, providerTxID string
+		err := tx.QueryRow("SELECT method_type, provider_tx_id FROM transactions WHERE client_id = $1 AND reference_code = $2",
+			t.ClientID, t.ReversalOf).Scan(&method, &providerTxID)
+		if err != nil || !countsAsWager(method, providerTxID, "") {
+			return err
+		}
+		_, err = tx.Exec("UPDATE bonus_grants SET wagered = GREATEST(wagered - $3, 0) WHERE id = "+
+			" (SELECT id FROM bonus_grants WHERE client_id = $1 AND address = $2 AND status = $4 ORDER BY id LIMIT 1)",
+			t.ClientID, t.Address, t.DrAmount+t.CrAmount, BonusActive)
+		return err
+	}
+	if !countsAsWager(t.MethodType, t.ProviderTxID, t.ReversalOf) {
+		return nil
+	}
+
+	rows, err := tx.Query("SELECT "+bonusGrantColumns+" FROM bonus_grants "+
+		" WHERE client_id = $1 AND address = $2 AND status = $3 ORDER BY id FOR UPDATE", t.ClientID, t.Address, BonusActive)
+	if err != nil {
+		return err
+	}
+	var grants []BonusGrant
+	for rows.Next() {
+		var g BonusGrant
+		if err := scanBonusGrant(rows, &g); err != nil {
+			rows.Close()
+			return err
+		}
+		grants = append(grants, g)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	left := t.DrAmount
+	for i := range grants {
+		g := &grants[i]
+		if left == 0 {
+			break
+		}
+		take := g.WageringLeft
+		if take > left {
+			take = left
+		}
+		left -= take
+		g.Wagered += take
+		_, err := tx.Exec("UPDATE bonus_grants SET wagered = $2 WHERE id = $1", g.ID, g.Wagered)
+		if err != nil {
+			return err
+		}
+		if g.Wagered >= g.WageringRequired {
+			if err = settleBonus(tx, g, BonusConverted); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyBonusSpend keep what is left of the active grants when bonus bucket money moves,
+// oldest grant first. A debit drawing on the bonus bucket uses the grants up, the reversal
+// of such a debit gives the money back. The caller must hold the Wallet row lock.
+func applyBonusSpend(tx *sql.Tx, t *Transaction) error {
+	switch t.MethodType {
+	case MethodBonus, MethodBonusConversion, MethodBonusForfeit:
+		// the grant itself and its settlement keep remaining on their own
+		if t.ReversalOf == "" {
+			return nil
+		}
+	}
+	var amt Amount
+	for _, b := range t.Buckets {
+		if b.Bucket == BucketBonus {
+			amt += b.Amount
+		}
+	}
+	if amt == 0 {
+		return nil
+	}
+
+	rows, err := tx.Query("SELECT id, amount, remaining FROM bonus_grants "+
+		" WHERE client_id = $1 AND address = $2 AND status = $3 ORDER BY id FOR UPDATE", t.ClientID, t.Address, BonusActive)
+	if err != nil {
+		return err
+	}
+	type grantUse struct {
+		id  int
+		amt Amount
+	}
+	var uses []grantUse
+	for rows.Next() && amt > 0 {
+		var u grantUse
+		var amount, remaining Amount
+		if err := rows.Scan(&u.id, &amount, &remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		u.amt = remaining
+		if t.TransactionType == "cr" {
+			u.amt = amount - remaining
+		}
+		if u.amt > amt {
+			u.amt = amt
+		}
+		amt -= u.amt
+		uses = append(uses, u)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, u := range uses {
+		if t.TransactionType != "cr" {
+			u.amt = -u.amt
+		}
+		_, err := tx.Exec("UPDATE bonus_grants SET remaining = remaining + $2 WHERE id = $1", u.id, u.amt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// countsAsWager tells if a debit counts towards wagering, only seamless bets do and not
+// their reversals
+func countsAsWager(method, providerTxID, reversalOf string) bool {
+	return method == SeamlessBet && providerTxID != "" && reversalOf == ""
+}
+
+// lockedBonus return the bonus bucket balance while the e-Wallet has an active grant, money
+// plain debits and transfers may not spend
+func lockedBonus(q querier, id int, guid string) (Amount, error) {
+	var locked Amount
+	err := q.QueryRow("SELECT balance FROM wallet_buckets WHERE client_id = $1 AND address = $2 AND bucket = $3 "+
+		" AND EXISTS (SELECT 1 FROM bonus_grants WHERE client_id = $1 AND address = $2 AND status = $4)",
+		id, guid, BucketBonus, BonusActive).Scan(&locked)
+	if err == sql.ErrNoRows || locked < 0 {
+		return 0, nil
+	}
+
+	return locked, err
+}
+
+// settleBonus close the grant. A conversion moves what is left of the grant in the bonus bucket
+// to cash, a forfeit debits it. Never more than the bucket or the balance holds is moved so no
+// overdraft is drawn.
+func settleBonus(tx *sql.Tx, g *BonusGrant, status string) error {
+	var bonus, balance Amount
+	err := tx.QueryRow("SELECT w.balance, COALESCE(b.balance, 0) FROM wallets w "+
+		" LEFT JOIN wallet_buckets b ON b.client_id = w.client_id AND b.address = w.address AND b.bucket = $3 "+
+		" WHERE w.client_id = $1 AND w.address = $2", g.ClientID, g.Address, BucketBonus).Scan(&balance, &bonus)
+	if err != nil {
+		return err
+	}
+	amt := g.Remaining
+	if amt > bonus {
+		amt = bonus
+	}
+	if amt > balance {
+		amt = balance
+	}
+
+	if amt > 0 {
+		method := MethodBonusForfeit
+		particulars := fmt.Sprintf("Forfeited bonus %s", g.ReferenceCode)
+		if status == BonusConverted {
+			method = MethodBonusConversion
+			particulars = fmt.Sprintf("Converted bonus %s", g.ReferenceCode)
+		}
+		dr := Transaction{
+			ClientID:          g.ClientID,
+			Address:           g.Address,
+			TransactionType:   "dr",
+			DrAmount:          amt,
+			MethodType:        method,
+			Particulars:       particulars,
+			ExternalReference: g.ReferenceCode,
+			Buckets:           BucketBreakdown{{Bucket: BucketBonus, Amount: amt}},
+			noLimits:          true,
+		}
+		if err = postTransaction(tx, &dr); err != nil {
+			return err
+		}
+		if status == BonusConverted {
+			cr := dr
+			cr.ID, cr.ReferenceCode = 0, ""
+			cr.TransactionType = "cr"
+			cr.CrAmount = amt
+			cr.Buckets = BucketBreakdown{{Bucket: BucketCash, Amount: amt}}
+			if err = postTransaction(tx, &cr); err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanBonusGrant(tx.QueryRow("UPDATE bonus_grants SET status = $2, remaining = 0, settled_amount = $3, settled_at = $4 "+
+		" WHERE id = $1 RETURNING "+bonusGrantColumns, g.ID, status, amt, time.Now().Local()), g)
+}
+
+// ForfeitBonuses forfeit every active grant past its expiry, returns how many were forfeited
+func (db *DB) ForfeitBonuses() (int, error) {
+	rows, err := db.Query("SELECT id, client_id, address FROM bonus_grants WHERE status = $1 AND expires_at <= $2 "+
+		" ORDER BY expires_at, id", BonusActive, time.Now().Local())
+	if err != nil {
+		return 0, err
+	}
+	var due []BonusGrant
+	for rows.Next() {
+		var g BonusGrant
+		if err := rows.Scan(&g.ID, &g.ClientID, &g.Address); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, g)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	forfeited := 0
+	for _, d := range due {
+		// one transaction per grant so a failing wallet does not hold back the others
+		err := db.withTx(func(tx *sql.Tx) error {
+			if err := lockWallet(tx, d.ClientID, d.Address); err != nil {
+				return err
+			}
+			var g BonusGrant
+			err := scanBonusGrant(tx.QueryRow("SELECT "+bonusGrantColumns+" FROM bonus_grants WHERE id = $1 FOR UPDATE",
+				d.ID), &g)
+			if err != nil || g.Status != BonusActive {
+				// converted or forfeited meanwhile
+				return err
+			}
+
+			return settleBonus(tx, &g, BonusForfeited)
+		})
+		if err != nil {
+			log.Println("Forfeit bonus ", d.ID, ": ", err)
+			continue
+		}
+		forfeited++
+	}
+
+	return forfeited, nil
+}
@@ -0,0 +1,328 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrUnknownBucket is returned for a bucket name that is not cash, bonus or promo,
+// or a precedence that lists a bucket twice
+var ErrUnknownBucket = errors.New("Unknown or repeated balance bucket")
+
+// ErrBucketBreakdown is returned when a given bucket breakdown does not add up to the amount
+var ErrBucketBreakdown = errors.New("Bucket breakdown does not match the amount")
+
+// balance buckets of a Wallet
+const (
+	BucketCash  = "cash"
+	BucketBonus = "bonus"
+	BucketPromo = "promo"
+)
+
+// DefaultBucketPrecedence is the order debits draw from the buckets unless the Wallet sets its own
+var DefaultBucketPrecedence = []string{BucketCash, BucketBonus, BucketPromo}
+
+// BucketAmount is the part of a balance or a posting held by one bucket
+type BucketAmount struct {
+	Bucket string `json:"bucket"`
+	Amount Amount `json:"amount"`
+}
+
+// BucketBreakdown is the per-bucket split of a Transaction, stored as JSON
+type BucketBreakdown []BucketAmount
+
+// Scan read the JSON column
+func (b *BucketBreakdown) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*b = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, b)
+	case string:
+		return json.Unmarshal([]byte(v), b)
+	}
+
+	return fmt.Errorf("Cannot scan %T into BucketBreakdown", src)
+}
+
+// Value write the breakdown as JSON
+func (b BucketBreakdown) Value() (driver.Value, error) {
+	if len(b) == 0 {
+		return "[]", nil
+	}
+	v, err := json.Marshal(b)
+
+	return string(v), err
+}
+
+// add put amt on bucket, merging with an existing entry
+func (b BucketBreakdown) add(bucket string, amt Amount) BucketBreakdown {
+	for i := range b {
+		if b[i].Bucket == bucket {
+			b[i].Amount += amt
+			return b
+		}
+	}
+
+	return append(b, BucketAmount{Bucket: bucket, Amount: amt})
+}
+
+// WalletBuckets is the per-bucket balance of a Wallet and the order debits draw from them
+type WalletBuckets struct {
+	Address    string         `json:"address"`
+	Currency   string         `json:"currency"`
+	Balance    Amount         `json:"balance"`
+	Precedence []string       `json:"precedence"`
+	Buckets    []BucketAmount `json:"buckets"`
+}
+
+// GetWalletBuckets return the bucket balances of the e-Wallet
+func (db *DB) GetWalletBuckets(id int, guid string) (*WalletBuckets, error) {
+	return getWalletBuckets(db, id, guid)
+}
+
+// SetBucketPrecedence change the order debits draw from the buckets, buckets left out keep
+// their default order after the listed ones
+func (db *DB) SetBucketPrecedence(id int, guid string, precedence []string) (*WalletBuckets, error) {
+	seen := map[string]bool{}
+	for _, b := range precedence {
+		if !isBucket(b) || seen[b] {
+			return nil, ErrUnknownBucket
+		}
+		seen[b] = true
+	}
+	for _, b := range DefaultBucketPrecedence {
+		if !seen[b] {
+			precedence = append(precedence, b)
+		}
+	}
+
+	r, err := db.Exec("UPDATE wallets SET bucket_precedence = $3, updated_at = $4 WHERE client_id = $1 AND address = $2",
+		id, guid, strings.Join(precedence, ","), time.Now().Local())
+	if err != nil {
+		return nil, err
+	}
+	if c, _ := r.RowsAffected(); c == 0 {
+		return nil, ErrWalletNotActive
+	}
+
+	return getWalletBuckets(db, id, guid)
+}
+
+func getWalletBuckets(q querier, id int, guid string) (*WalletBuckets, error) {
+	wb := WalletBuckets{Address: guid}
+	var precedence string
+	err := q.QueryRow("SELECT currency, balance, bucket_precedence FROM wallets WHERE client_id = $1 AND address = $2",
+		id, guid).Scan(&wb.Currency, &wb.Balance, &precedence)
+	if err == sql.ErrNoRows {
+		return nil, ErrWalletNotActive
+	}
+	if err != nil {
+		return nil, err
+	}
+	wb.Precedence = strings.Split(precedence, ",")
+
+	balances, err := bucketBalances(q, id, guid)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range wb.Precedence {
+		wb.Buckets = append(wb.Buckets, BucketAmount{Bucket: b, Amount: balances[b]})
+	}
+
+	return &wb, nil
+}
+
+// applyBuckets move the cr/dr amount in the Wallet buckets and record the breakdown on t.
+// A credit goes to t.Bucket (cash by default) unless t.Buckets is already set. A debit draws
+// from t.Bucket first, then in the Wallet precedence, what is left overdraws cash. A debit
+// that keeps the bonus skips the bonus bucket while a grant is being wagered.
+// The caller must hold the Wallet row lock.
+func applyBuckets(tx *sql.Tx, t *Transaction) error {
+	if t.Bucket != "" && !isBucket(t.Bucket) {
+		return ErrUnknownBucket
+	}
+
+	locked := Amount(0)
+	if t.keepBonus {
+		var err error
+		if locked, err = lockedBonus(tx, t.ClientID, t.Address); err != nil {
+			return err
+		}
+	}
+
+	if len(t.Buckets) > 0 {
+		var sum Amount
+		for _, b := range t.Buckets {
+			if !isBucket(b.Bucket) || b.Amount < 0 {
+				return ErrUnknownBucket
+			}
+			if locked > 0 && b.Bucket == BucketBonus && b.Amount > 0 {
+				return ErrBonusLocked
+			}
+			sum += b.Amount
+		}
+		if sum != t.CrAmount+t.DrAmount {
+			return ErrBucketBreakdown
+		}
+	} else {
+		if t.TransactionType == "cr" {
+			bucket := t.Bucket
+			if bucket == "" {
+				bucket = BucketCash
+			}
+			t.Buckets = BucketBreakdown{{Bucket: bucket, Amount: t.CrAmount}}
+		} else {
+			breakdown, err := drawBuckets(tx, t, locked > 0)
+			if err != nil {
+				return err
+			}
+			t.Buckets = breakdown
+		}
+	}
+
+	for _, b := range t.Buckets {
+		amt := b.Amount
+		if t.TransactionType != "cr" {
+			amt = -amt
+		}
+		_, err := tx.Exec("INSERT INTO wallet_buckets (client_id, address, bucket, balance) VALUES ($1, $2, $3, $4) "+
+			" ON CONFLICT (client_id, address, bucket) DO UPDATE SET balance = wallet_buckets.balance + $4",
+			t.ClientID, t.Address, b.Bucket, amt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// drawBuckets split the debit amount over the buckets, leaving out the bonus bucket when skipBonus
+func drawBuckets(q querier, t *Transaction, skipBonus bool) (BucketBreakdown, error) {
+	var precedence string
+	err := q.QueryRow("SELECT bucket_precedence FROM wallets WHERE client_id = $1 AND address = $2",
+		t.ClientID, t.Address).Scan(&precedence)
+	if err != nil {
+		return nil, err
+	}
+	order := strings.Split(precedence, ",")
+	if t.Bucket != "" {
+		order = append([]string{t.Bucket}, order...)
+	}
+
+	balances, err := bucketBalances(q, t.ClientID, t.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var breakdown BucketBreakdown
+	remaining := t.DrAmount
+	for _, b := range order {
+		if remaining == 0 {
+			break
+		}
+		take := balances[b]
+		if take <= 0 || (skipBonus && b == BucketBonus) {
+			continue
+		}
+		if take > remaining {
+			take = remaining
+		}
+		balances[b] -= take
+		remaining -= take
+		breakdown = breakdown.add(b, take)
+	}
+	if remaining > 0 {
+		// past the buckets the debit runs on the credit line, which is cash
+		breakdown = breakdown.add(BucketCash, remaining)
+	}
+
+	return breakdown, nil
+}
+
+// bucketBalances return the balance of each bucket of the Wallet
+func bucketBalances(q querier, id int, guid string) (map[string]Amount, error) {
+	rows, err := q.Query("SELECT bucket, balance FROM wallet_buckets WHERE client_id = $1 AND address = $2", id, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	balances := map[string]Amount{}
+	for rows.Next() {
+		var b string
+		var amt Amount
+		if err := rows.Scan(&b, &amt); err != nil {
+			return nil, err
+		}
+		balances[b] = amt
+	}
+
+	return balances, rows.Err()
+}
+
+// reversalBuckets return the breakdown that gives back amt of the dr orig to the buckets it
+// was drawn from, less what earlier reversals already gave back
+func reversalBuckets(q querier, orig *Transaction, amt Amount) (BucketBreakdown, error) {
+	rows, err := q.Query("SELECT buckets FROM transactions WHERE client_id = $1 AND reversal_of = $2",
+		orig.ClientID, orig.ReferenceCode)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	left := BucketBreakdown{}
+	for _, b := range orig.Buckets {
+		left = left.add(b.Bucket, b.Amount)
+	}
+	for rows.Next() {
+		var given BucketBreakdown
+		if err := rows.Scan(&given); err != nil {
+			return nil, err
+		}
+		for _, b := range given {
+			left = left.add(b.Bucket, -b.Amount)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var breakdown BucketBreakdown
+	for _, b := range left {
+		if amt == 0 {
+			break
+		}
+		take := b.Amount
+		if take <= 0 {
+			continue
+		}
+		if take > amt {
+			take = amt
+		}
+		amt -= take
+		breakdown = breakdown.add(b.Bucket, take)
+	}
+	if amt > 0 {
+		// rows posted before buckets have no breakdown
+		breakdown = breakdown.add(BucketCash, amt)
+	}
+
+	return breakdown, nil
+}
+
+func isBucket(b string) bool {
+	for _, known := range DefaultBucketPrecedence {
+		if b == known {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	// ErrUnknownMethodType is returned for a method type missing from the client catalog
+	// or not allowed in the posting direction
+	ErrUnknownMethodType = errors.New("Method type not in the client catalog or not allowed for this direction")
+	// ErrUnknownFundType is returned for a fund type missing from the client catalog
+	ErrUnknownFundType = errors.New("Fund type not in the client catalog")
+	// ErrInvalidCatalogEntry is returned for a catalog entry without a code or with an unknown direction
+	ErrInvalidCatalogEntry = errors.New("Catalog entry needs a code and a direction of credit, debit or both")
+	// ErrCatalogEntryNotFound is returned when deleting an unknown catalog entry
+	ErrCatalogEntryNotFound = errors.New("Catalog entry not found")
+)
+
+// method type directions
+const (
+	DirectionCredit = "credit"
+	DirectionDebit  = "debit"
+	DirectionBoth   = "both"
+)
+
+// MethodType is an allowed Transaction.MethodType of the client and the postings it may be used on.
+// A client without method types in its catalog accepts any method type.
+type MethodType struct {
+	ClientID  int       `json:"-"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Direction string    `json:"direction"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// FundType is an allowed Wallet.FundType of the client. A client without fund types in its
+// catalog accepts any fund type.
+type FundType struct {
+	ClientID  int       `json:"-"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SetMethodType create or replace a method type of the client catalog
+func (db *DB) SetMethodType(m *MethodType) error {
+	if m.Code == "" || (m.Direction != DirectionCredit && m.Direction != DirectionDebit && m.Direction != DirectionBoth) {
+		return ErrInvalidCatalogEntry
+	}
+
+	now := time.Now().Local()
+	return db.QueryRow("INSERT INTO method_types (client_id, code, name, direction, created_at, updated_at) "+
+		" VALUES ($1, $2, $3, $4, $5, $5) ON CONFLICT (client_id, code) DO UPDATE SET name = $3, direction = $4, "+
+		" updated_at = $5 RETURNING created_at, updated_at",
+		m.ClientID, m.Code, m.Name, m.Direction, now).Scan(&m.CreatedAt, &m.UpdatedAt)
+}
+
+// GetAllMethodType return the method type catalog of the client
+func (db *DB) GetAllMethodType(id int) ([]MethodType, error) {
+	rows, err := db.Query("SELECT client_id, code, name, direction, created_at, updated_at FROM method_types "+
+		" WHERE client_id = $1 ORDER BY code", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var methods []MethodType
+	for rows.Next() {
+		var m MethodType
+		err := rows.Scan(&m.ClientID, &m.Code, &m.Name, &m.Direction, &m.CreatedAt, &m.UpdatedAt)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		methods = append(methods, m)
+	}
+
+	return methods, nil
+}
+
+// DeleteMethodType remove a method type from the client catalog
+func (db *DB) DeleteMethodType(id int, code string) error {
+	return deleteCatalogEntry(db, "DELETE FROM method_types WHERE client_id = $1 AND code = $2", id, code)
+}
+
+// SetFundType create or replace a fund type of the client catalog
+func (db *DB) SetFundType(f *FundType) error {
+	if f.Code == "" {
+		return ErrInvalidCatalogEntry
+	}
+
+	now := time.Now().Local()
+	return db.QueryRow("INSERT INTO fund_types (client_id, code, name, created_at, updated_at) "+
+		" VALUES ($1, $2, $3, $4, $4) ON CONFLICT (client_id, code) DO UPDATE SET name = $3, updated_at = $4 "+
+		" RETURNING created_at, updated_at",
+		f.ClientID, f.Code, f.Name, now).Scan(&f.CreatedAt, &f.UpdatedAt)
+}
+
+// GetAllFundType return the fund type catalog of the client
+func (db *DB) GetAllFundType(id int) ([]FundType, error) {
+	rows, err := db.Query("SELECT client_id, code, name, created_at, updated_at FROM fund_types "+
+		" WHERE client_id = $1 ORDER BY code", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var funds []FundType
+	for rows.Next() {
+		var f FundType
+		err := rows.Scan(&f.ClientID, &f.Code, &f.Name, &f.CreatedAt, &f.UpdatedAt)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		funds = append(funds, f)
+	}
+
+	return funds, nil
+}
+
+// DeleteFundType remove a fund type from the client catalog, existing wallets keep their fund type
+func (db *DB) DeleteFundType(id int, code string) error {
+	return deleteCatalogEntry(db, "DELETE FROM fund_types WHERE client_id = $1 AND code = $2", id, code)
+}
+
+// CheckMethodType tell if the method type may be used on a cr or dr of the client
+func (db *DB) CheckMethodType(id int, code, transactionType string) error {
+	direction := DirectionDebit
+	if transactionType == "cr" {
+		direction = DirectionCredit
+	}
+
+	var allowed bool
+	err := db.QueryRow("SELECT COALESCE(bool_or(code = $2 AND direction IN ($3, $4)), TRUE) FROM method_types "+
+		" WHERE client_id = $1", id, code, direction, DirectionBoth).Scan(&allowed)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrUnknownMethodType
+	}
+
+	return nil
+}
+
+// CheckFundType tell if the client accepts wallets of the fund type
+func (db *DB) CheckFundType(id int, code string) error {
+	return checkFundType(db, id, code)
+}
+
+func checkFundType(q querier, id int, code string) error {
+	var allowed bool
+	err := q.QueryRow("SELECT COALESCE(bool_or(code = $2), TRUE) FROM fund_types WHERE client_id = $1",
+		id, code).Scan(&allowed)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrUnknownFundType
+	}
+
+	return nil
+}
+
+func deleteCatalogEntry(q querier, query string, id int, code string) error {
+	r, err := q.Exec(query, id, code)
+	if err != nil {
+		return err
+	}
+	if c, _ := r.RowsAffected(); c == 0 {
+		return ErrCatalogEntryNotFound
+	}
+
+	return nil
+}
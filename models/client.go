@@ -20,6 +20,11 @@ type Client struct {
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 	DeletedAt time.Time `json:"deletedAt"`
+
+	// DefaultCurrency is given to wallets created without a currency
+	DefaultCurrency string `json:"defaultCurrency"`
+	// UniqueFundType allows a single wallet per user and fund type
+	UniqueFundType *bool `json:"uniqueFundType,omitempty"`
 }
 
 // CreateClient create new client in DB
@@ -30,9 +35,18 @@ func (db *DB) CreateClient(client *Client) (int, error) {
 	uAt := time.Now().Local()
 	uid := xid.New()
 
-	err := db.QueryRow("INSERT INTO clients (uuid, name, token, address, url, reference, created_at, updated_at) "+
-		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;",
-		uid.String(), client.Name, client.Token, client.Address, client.URL, client.Reference, cAt, uAt).Scan(&lastInsertID)
+	if client.DefaultCurrency == "" {
+		client.DefaultCurrency = DefaultCurrency
+	}
+	c, err := getCurrency(db, client.DefaultCurrency)
+	if err != nil {
+		return 0, err
+	}
+
+	err = db.QueryRow("INSERT INTO clients (uuid, name, token, address, url, reference, default_currency, unique_fund_type, "+
+		" created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8, FALSE), $9, $10) RETURNING id;",
+		uid.String(), client.Name, client.Token, client.Address, client.URL, client.Reference, c.Code, client.UniqueFundType,
+		cAt, uAt).Scan(&lastInsertID)
 	if err != nil {
 		return 0, err
 	}
@@ -42,7 +56,7 @@ func (db *DB) CreateClient(client *Client) (int, error) {
 
 // GetAllClient return all clients
 func (db *DB) GetAllClient() ([]Client, error) {
-	rows, err := db.Query("SELECT uuid, name, token, address, url, reference, is_active FROM clients;")
+	rows, err := db.Query("SELECT uuid, name, token, address, url, reference, default_currency, unique_fund_type, is_active FROM clients;")
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +64,7 @@ func (db *DB) GetAllClient() ([]Client, error) {
 	var clients []Client
 	for rows.Next() {
 		var c Client
-		err := rows.Scan(&c.UUID, &c.Name, &c.Token, &c.Address, &c.URL, &c.Reference, &c.IsActive)
+		err := rows.Scan(&c.UUID, &c.Name, &c.Token, &c.Address, &c.URL, &c.Reference, &c.DefaultCurrency, &c.UniqueFundType, &c.IsActive)
 		if err != nil {
 			log.Println(err)
 			continue
@@ -60,10 +74,73 @@ func (db *DB) GetAllClient() ([]Client, error) {
 	return clients, nil
 }
 
+// ClientFilter narrows a client listing, Name matches any part of the name ignoring case
+type ClientFilter struct {
+	Name     string
+	IsActive *bool
+}
+
+// GetClientPage return one page of the clients matching f, sorted by creation time
+func (db *DB) GetClientPage(f *ClientFilter, pr PageRequest) ([]Client, *Paging, error) {
+	k, err := pr.keyset()
+	if err != nil {
+		return nil, nil, err
+	}
+	afterAt, afterID := k.args()
+
+	var isActive interface{}
+	if f.IsActive != nil {
+		isActive = *f.IsActive
+	}
+
+	rows, err := db.Query("SELECT id, uuid, name, token, address, url, reference, default_currency, unique_fund_type, is_active, "+
+		" created_at, updated_at "+
+		" FROM clients WHERE ($1 = '' OR name ILIKE '%' || $1 || '%') AND ($2::boolean IS NULL OR is_active = $2) "+
+		" AND ($3::timestamp IS NULL OR (created_at, id) "+k.op+" ($3, $4)) "+
+		" ORDER BY created_at "+k.order+", id "+k.order+" LIMIT $5",
+		f.Name, isActive, afterAt, afterID, k.limit+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var clients []Client
+	for rows.Next() {
+		var c Client
+		err := rows.Scan(&c.id, &c.UUID, &c.Name, &c.Token, &c.Address, &c.URL, &c.Reference, &c.DefaultCurrency,
+			&c.UniqueFundType, &c.IsActive, &c.CreatedAt, &c.UpdatedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		clients = append(clients, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	n := len(clients)
+	if n > k.limit {
+		clients = clients[:k.limit]
+	}
+	if k.backwards() {
+		for i, j := 0, len(clients)-1; i < j; i, j = i+1, j-1 {
+			clients[i], clients[j] = clients[j], clients[i]
+		}
+	}
+	if len(clients) == 0 {
+		return clients, k.paging(0, time.Time{}, 0, time.Time{}, 0), nil
+	}
+	first, last := clients[0], clients[len(clients)-1]
+
+	return clients, k.paging(n, first.CreatedAt, first.id, last.CreatedAt, last.id), nil
+}
+
 // UpdateClientByID update client info
 func (db *DB) UpdateClientByID(id int, client *Client) (int64, error) {
-	r, err := db.Exec("UPDATE clients SET name=$2, address=$3, url=$4, reference=$5, is_active=$6 "+
-		" WHERE id=$1;", id, client.Name, client.Address, client.URL, client.Reference, client.IsActive)
+	r, err := db.Exec("UPDATE clients SET name=$2, address=$3, url=$4, reference=$5, is_active=$6, "+
+		" default_currency=COALESCE(NULLIF(UPPER($7), ''), default_currency), unique_fund_type=COALESCE($8, unique_fund_type) "+
+		" WHERE id=$1;", id, client.Name, client.Address, client.URL, client.Reference, client.IsActive, client.DefaultCurrency,
+		client.UniqueFundType)
 	if err != nil {
 		return 0, err
 	}
@@ -77,8 +154,10 @@ func (db *DB) UpdateClientByID(id int, client *Client) (int64, error) {
 
 // UpdateClientByUUID update client info
 func (db *DB) UpdateClientByUUID(uuid string, client *Client) (int64, error) {
-	r, err := db.Exec("UPDATE clients SET name=$2, address=$3, url=$4, reference=$5, is_active=$6 "+
-		" WHERE uuid=$1;", uuid, client.Name, client.Address, client.URL, client.Reference, client.IsActive)
+	r, err := db.Exec("UPDATE clients SET name=$2, address=$3, url=$4, reference=$5, is_active=$6, "+
+		" default_currency=COALESCE(NULLIF(UPPER($7), ''), default_currency), unique_fund_type=COALESCE($8, unique_fund_type) "+
+		" WHERE uuid=$1;", uuid, client.Name, client.Address, client.URL, client.Reference, client.IsActive, client.DefaultCurrency,
+		client.UniqueFundType)
 	if err != nil {
 		return 0, err
 	}
@@ -93,9 +172,11 @@ func (db *DB) UpdateClientByUUID(uuid string, client *Client) (int64, error) {
 // GetClientByID return client object
 func (db *DB) GetClientByID(id int) (*Client, error) {
 	var c Client
-	err := db.QueryRow("SELECT id, uuid, name, token, address, url, reference, is_active, created_at, updated_at, deleted_at "+
+	err := db.QueryRow("SELECT id, uuid, name, token, address, url, reference, default_currency, unique_fund_type, is_active, "+
+		" created_at, updated_at, deleted_at "+
 		" FROM clients WHERE id=$1;", id).Scan(
-		&c.id, &c.UUID, &c.Name, &c.Token, &c.Address, &c.URL, &c.Reference, &c.IsActive, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt)
+		&c.id, &c.UUID, &c.Name, &c.Token, &c.Address, &c.URL, &c.Reference, &c.DefaultCurrency, &c.UniqueFundType, &c.IsActive,
+		&c.CreatedAt, &c.UpdatedAt, &c.DeletedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -106,9 +187,11 @@ func (db *DB) GetClientByID(id int) (*Client, error) {
 // GetClientByUUID return client info
 func (db *DB) GetClientByUUID(uuid string) (*Client, error) {
 	var c Client
-	err := db.QueryRow("SELECT id, uuid, name, token, address, url, reference, is_active, created_at, updated_at, deleted_at "+
+	err := db.QueryRow("SELECT id, uuid, name, token, address, url, reference, default_currency, unique_fund_type, is_active, "+
+		" created_at, updated_at, deleted_at "+
 		" FROM clients WHERE uuid=$1;", uuid).Scan(
-		&c.id, &c.UUID, &c.Name, &c.Token, &c.Address, &c.URL, &c.Reference, &c.IsActive, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt)
+		&c.id, &c.UUID, &c.Name, &c.Token, &c.Address, &c.URL, &c.Reference, &c.DefaultCurrency, &c.UniqueFundType, &c.IsActive,
+		&c.CreatedAt, &c.UpdatedAt, &c.DeletedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCron is returned for a cron expression that is not five valid fields
+var ErrInvalidCron = errors.New("Invalid cron expression, expected minute hour day-of-month month day-of-week")
+
+// cronSpec is a parsed five field cron expression, each field is the set of matching values
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	// anyDom and anyDow are set for a * field, when both days are restricted either one matches
+	anyDom, anyDow bool
+}
+
+// cronFields are the bounds of the minute, hour, day of month, month and day of week fields
+var cronFields = [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// parseCron read an expression like "30 8 * * 1-5" or "*/15 * * * *",
+// fields take *, values, ranges, lists and /steps, Sunday is 0 or 7
+func parseCron(expr string) (*cronSpec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, ErrInvalidCron
+	}
+
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := parseCronField(f, cronFields[i][0], cronFields[i][1], i == 4)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	return &cronSpec{
+		minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		anyDom: fields[2] == "*", anyDow: fields[4] == "*",
+	}, nil
+}
+
+func parseCronField(f string, min, max int, weekday bool) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(f, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, ErrInvalidCron
+			}
+			part = part[:i]
+		}
+
+		lo, hi := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, ErrInvalidCron
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, ErrInvalidCron
+				}
+			} else if step > 1 {
+				// "5/15" runs from 5 to the end of the range
+				hi = max
+			}
+		}
+		top := max
+		if weekday {
+			top = 7
+		}
+		if lo < min || hi > top || lo > hi {
+			return 0, ErrInvalidCron
+		}
+
+		for v := lo; v <= hi; v += step {
+			if weekday && v == 7 {
+				v = 0
+				set |= 1
+				break
+			}
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+// next return the first minute after t that matches the expression, zero when none
+// matches within five years (e.g. "0 0 30 2 *")
+func (c *cronSpec) next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (c *cronSpec) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.anyDom || c.anyDow {
+		return dom && dow
+	}
+
+	return dom || dow
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr   string
+		minute uint64
+		dow    uint64
+		err    bool
+	}{
+		{expr: "* * * * *", minute: 1<<60 - 1, dow: 1<<7 - 1},
+		{expr: "30 8 * * 1-5", minute: 1 << 30, dow: 0x3e},
+		{expr: "*/15 * * * *", minute: 1<<0 | 1<<15 | 1<<30 | 1<<45, dow: 1<<7 - 1},
+		{expr: "5/15 * * * *", minute: 1<<5 | 1<<20 | 1<<35 | 1<<50, dow: 1<<7 - 1},
+		{expr: "0,10-12 * * * 0", minute: 1<<0 | 1<<10 | 1<<11 | 1<<12, dow: 1},
+		{expr: "0 0 * * 7", minute: 1, dow: 1},
+		{expr: "0 0 * * 5-7", minute: 1, dow: 1<<5 | 1<<6 | 1},
+		{expr: "  0   0 * *   *  ", minute: 1, dow: 1<<7 - 1},
+		{expr: "", err: true},
+		{expr: "* * * *", err: true},
+		{expr: "* * * * * *", err: true},
+		{expr: "60 * * * *", err: true},
+		{expr: "* 24 * * *", err: true},
+		{expr: "* * 0 * *", err: true},
+		{expr: "* * * 13 *", err: true},
+		{expr: "* * * * 8", err: true},
+		{expr: "*/0 * * * *", err: true},
+		{expr: "a * * * *", err: true},
+		{expr: "5-1 * * * *", err: true},
+		{expr: "1-x * * * *", err: true},
+	}
+
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if tt.err {
+			if err != ErrInvalidCron {
+				t.Errorf("parseCron(%q) error = %v, want ErrInvalidCron", tt.expr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseCron(%q) error = %v", tt.expr, err)
+			continue
+		}
+		if c.minute != tt.minute || c.dow != tt.dow {
+			t.Errorf("parseCron(%q) minute = %b, dow = %b, want %b, %b", tt.expr, c.minute, c.dow, tt.minute, tt.dow)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// a Sunday
+	from := time.Date(2026, 10, 18, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2026, 10, 18, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2026, 10, 18, 10, 15, 0, 0, time.UTC)},
+		// strictly after the given minute
+		{"*/15 * * * *", time.Date(2026, 10, 18, 10, 15, 0, 0, time.UTC), time.Date(2026, 10, 18, 10, 30, 0, 0, time.UTC)},
+		{"30 8 * * 1-5", from, time.Date(2026, 10, 19, 8, 30, 0, 0, time.UTC)},
+		{"0 9 * * 0", from, time.Date(2026, 10, 25, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", from, time.Date(2026, 10, 25, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", from, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"59 23 31 12 *", from, time.Date(2026, 12, 31, 23, 59, 0, 0, time.UTC)},
+		{"0 10 18 10 *", from, time.Date(2027, 10, 18, 10, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// both days restricted: the 13th or a Friday, whichever comes first
+		{"0 12 13 * 5", from, time.Date(2026, 10, 23, 12, 0, 0, 0, time.UTC)},
+		// day of month restricted only
+		{"0 12 13 * *", from, time.Date(2026, 11, 13, 12, 0, 0, 0, time.UTC)},
+		// never matches
+		{"0 0 30 2 *", from, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		c, err := parseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tt.expr, err)
+		}
+		if got := c.next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("next(%q, %s) = %s, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
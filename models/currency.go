@@ -0,0 +1,162 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// DefaultCurrency is used for clients created without a default currency
+const DefaultCurrency = "PHP"
+
+var (
+	// ErrUnknownCurrency is returned when the currency code is not in the registry
+	ErrUnknownCurrency = errors.New("Unknown currency")
+	// ErrCurrencyMismatch is returned when posting in another currency than the e-Wallet currency
+	ErrCurrencyMismatch = errors.New("Currency does not match the e-Wallet currency")
+	// ErrAmountPrecision is returned when an amount has more decimals than its currency allows
+	ErrAmountPrecision = errors.New("Amount has more decimals than the currency allows")
+	// ErrCurrencyInUse is returned when changing the minor units or rounding of a currency e-Wallets hold
+	ErrCurrencyInUse = errors.New("Currency precision can not change while e-Wallets hold it")
+)
+
+// Currency is an entry of the currency registry
+type Currency struct {
+	Code       string       `json:"code"`
+	Name       string       `json:"name"`
+	MinorUnits int          `json:"minorUnits"`
+	Rounding   RoundingMode `json:"rounding"`
+}
+
+// Round apply the currency precision and rounding to a computed amount
+func (c *Currency) Round(a Amount) Amount {
+	return a.Round(c.MinorUnits, c.Rounding)
+}
+
+// Mul return a times r rounded once, straight to the currency precision and rounding,
+// ErrInvalidAmount when it overflows
+func (c *Currency) Mul(a Amount, r Rate) (Amount, error) {
+	p := new(big.Rat).SetFrac(big.NewInt(int64(a)), big.NewInt(amountUnit))
+	p.Mul(p, r.rat())
+	unit := int64(1)
+	for i := 0; i < c.MinorUnits; i++ {
+		unit *= 10
+	}
+	v, err := fixedFromRat(p, unit, c.Rounding)
+	if err != nil || v > math.MaxInt64/(amountUnit/unit) || v < math.MinInt64/(amountUnit/unit) {
+		return 0, ErrInvalidAmount
+	}
+
+	return Amount(v * (amountUnit / unit)), nil
+}
+
+// IsValidAmount tell if a has no more decimals than the currency minor units
+func (c *Currency) IsValidAmount(a Amount) bool {
+	return a.Round(c.MinorUnits, RoundDown) == a
+}
+
+// CreateCurrency add or replace a currency in the registry, the minor units and rounding
+// of a currency e-Wallets already hold can not change
+func (db *DB) CreateCurrency(c *Currency) error {
+	c.Code = strings.ToUpper(c.Code)
+
+	return db.withTx(func(tx *sql.Tx) error {
+		var minorUnits int
+		var rounding RoundingMode
+		err := tx.QueryRow("SELECT minor_units, rounding FROM currencies WHERE code = $1 FOR UPDATE",
+			c.Code).Scan(&minorUnits, &rounding)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if err == nil && (minorUnits != c.MinorUnits || rounding != c.Rounding) {
+			var held bool
+			err = tx.QueryRow("SELECT EXISTS (SELECT 1 FROM wallets WHERE currency = $1)", c.Code).Scan(&held)
+			if err != nil {
+				return err
+			}
+			if held {
+				return ErrCurrencyInUse
+			}
+		}
+
+		_, err = tx.Exec("INSERT INTO currencies (code, name, minor_units, rounding) VALUES ($1, $2, $3, $4) "+
+			" ON CONFLICT (code) DO UPDATE SET name = $2, minor_units = $3, rounding = $4",
+			c.Code, c.Name, c.MinorUnits, c.Rounding)
+
+		return err
+	})
+}
+
+// GetCurrency return the registry entry of code
+func (db *DB) GetCurrency(code string) (*Currency, error) {
+	return getCurrency(db, code)
+}
+
+// GetAllCurrency return the currency registry
+func (db *DB) GetAllCurrency() ([]Currency, error) {
+	rows, err := db.Query("SELECT code, name, minor_units, rounding FROM currencies ORDER BY code")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var currencies []Currency
+	for rows.Next() {
+		var c Currency
+		err := rows.Scan(&c.Code, &c.Name, &c.MinorUnits, &c.Rounding)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		currencies = append(currencies, c)
+	}
+
+	return currencies, nil
+}
+
+func getCurrency(q querier, code string) (*Currency, error) {
+	var c Currency
+	err := q.QueryRow("SELECT code, name, minor_units, rounding FROM currencies WHERE code = $1",
+		strings.ToUpper(code)).Scan(&c.Code, &c.Name, &c.MinorUnits, &c.Rounding)
+	if err == sql.ErrNoRows {
+		return nil, ErrUnknownCurrency
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// walletCurrency check that amt can be posted to the e-Wallet in currency *code,
+// an empty *code is set to the e-Wallet currency
+func walletCurrency(q querier, id int, guid string, code *string, amt Amount) (*Currency, error) {
+	var walletCode string
+	err := q.QueryRow("SELECT currency FROM wallets WHERE client_id = $1 AND address = $2", id, guid).Scan(&walletCode)
+	if err == sql.ErrNoRows {
+		return nil, ErrWalletNotActive
+	}
+	if err != nil {
+		return nil, err
+	}
+	if *code == "" {
+		*code = walletCode
+	}
+	if !strings.EqualFold(*code, walletCode) {
+		return nil, ErrCurrencyMismatch
+	}
+	*code = walletCode
+
+	c, err := getCurrency(q, walletCode)
+	if err != nil {
+		return nil, err
+	}
+	if !c.IsValidAmount(amt) {
+		return nil, ErrAmountPrecision
+	}
+
+	return c, nil
+}
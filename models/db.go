@@ -11,6 +11,14 @@ type DB struct {
 	*sql.DB
 }
 
+// querier is implemented by both *sql.DB and *sql.Tx so the same
+// statements can run either standalone or inside a transaction
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 // NewDB return a DB Object using the dataSourceName
 func NewDB(dataSourceName string) (*DB, error) {
 	db, err := sql.Open("postgres", dataSourceName)
@@ -22,3 +30,17 @@ func NewDB(dataSourceName string) (*DB, error) {
 	}
 	return &DB{db}, nil
 }
+
+// withTx run fn inside a database transaction, commit if fn succeed else rollback
+func (db *DB) withTx(fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,10 @@
+package models
+
+import "errors"
+
+var (
+	// ErrWalletNotActive is returned when posting to a missing or inactive e-Wallet
+	ErrWalletNotActive = errors.New("e-Wallet not active")
+	// ErrInsufficientBalance is returned when a debit is over the e-Wallet balance
+	ErrInsufficientBalance = errors.New("Insufficient e-Wallet balance")
+)
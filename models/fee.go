@@ -0,0 +1,321 @@
+package models
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidFee is returned for a fee schedule without a method type, with a negative value,
+// a minimum over its maximum, unordered tiers or a netted debit
+var ErrInvalidFee = errors.New("Invalid fee schedule")
+
+// ErrFeeNotFound is returned when deleting an unknown fee schedule
+var ErrFeeNotFound = errors.New("Fee schedule not found")
+
+// MethodFee is the method type of the linked debit that charges a fee
+const MethodFee = "fee"
+
+// FeeTier is the flat and percentage fee of amounts up to UpTo, nil UpTo is the last tier.
+// Rate is a fraction of the amount like FeeSchedule.Rate
+type FeeTier struct {
+	UpTo *Amount `json:"upTo"`
+	Flat Amount  `json:"flat"`
+	Rate Rate    `json:"rate"`
+}
+
+// FeeTiers are the tiers of a fee schedule in UpTo order, stored as JSON
+type FeeTiers []FeeTier
+
+// Scan read the JSON column
+func (t *FeeTiers) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	}
+
+	return fmt.Errorf("Cannot scan %T into FeeTiers", src)
+}
+
+// Value write the tiers as JSON
+func (t FeeTiers) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return "[]", nil
+	}
+	v, err := json.Marshal(t)
+
+	return string(v), err
+}
+
+// FeeSchedule is the fee the client charges on a method type. Without tiers the fee is Flat plus
+// Rate times the amount, with tiers the first tier the amount fits in applies. Rate is a fraction,
+// not a percent: 0.015 is a 1.5% fee. MinFee and MaxFee cap the result. A Netted credit fee is
+// taken off the credit, otherwise a linked dr charges it.
+type FeeSchedule struct {
+	ID              int       `json:"id"`
+	ClientID        int       `json:"-"`
+	MethodType      string    `json:"methodType"`
+	TransactionType string    `json:"transactionType"`
+	Flat            Amount    `json:"flat"`
+	Rate            Rate      `json:"rate"`
+	Tiers           FeeTiers  `json:"tiers,omitempty"`
+	MinFee          *Amount   `json:"minFee"`
+	MaxFee          *Amount   `json:"maxFee"`
+	Netted          bool      `json:"netted"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// FeeBreakdown is how the fee of a posting was worked out
+type FeeBreakdown struct {
+	ScheduleID int    `json:"scheduleId"`
+	Base       Amount `json:"base"`
+	Flat       Amount `json:"flat"`
+	Percentage Amount `json:"percentage"`
+	// Fee is the charged fee after the min/max caps and the currency rounding
+	Fee    Amount `json:"fee"`
+	Netted bool   `json:"netted"`
+	// Net is the total balance change, the base less the fee on a credit and plus it on a debit
+	Net Amount `json:"net"`
+	// ReferenceCode is the linked fee dr, empty when netted
+	ReferenceCode string `json:"referenceCode,omitempty"`
+}
+
+// Scan read the JSON column
+func (f *FeeBreakdown) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, f)
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	}
+
+	return fmt.Errorf("Cannot scan %T into FeeBreakdown", src)
+}
+
+// Value write the breakdown as JSON
+func (f FeeBreakdown) Value() (driver.Value, error) {
+	v, err := json.Marshal(f)
+
+	return string(v), err
+}
+
+// feeScheduleColumns is the select list read by scanFeeSchedule
+const feeScheduleColumns = "id, client_id, method_type, transaction_type, flat, rate, tiers, min_fee, max_fee, " +
+	" netted, created_at, updated_at"
+
+func scanFeeSchedule(r rowScanner, s *FeeSchedule) error {
+	return r.Scan(&s.ID, &s.ClientID, &s.MethodType, &s.TransactionType, &s.Flat, &s.Rate, &s.Tiers, &s.MinFee,
+		&s.MaxFee, &s.Netted, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// SetFeeSchedule create or replace the fee schedule of the method type and transaction type
+func (db *DB) SetFeeSchedule(s *FeeSchedule) error {
+	if !s.valid() {
+		return ErrInvalidFee
+	}
+
+	now := time.Now().Local()
+	return scanFeeSchedule(db.QueryRow("INSERT INTO fee_schedules (client_id, method_type, transaction_type, flat, "+
+		" rate, tiers, min_fee, max_fee, netted, created_at, updated_at) "+
+		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10) "+
+		" ON CONFLICT (client_id, method_type, transaction_type) DO UPDATE SET flat = $4, rate = $5, tiers = $6, "+
+		" min_fee = $7, max_fee = $8, netted = $9, updated_at = $10 RETURNING "+feeScheduleColumns,
+		s.ClientID, s.MethodType, s.TransactionType, s.Flat, s.Rate, s.Tiers, s.MinFee, s.MaxFee, s.Netted, now), s)
+}
+
+// GetAllFeeSchedule return the fee schedules of the client
+func (db *DB) GetAllFeeSchedule(id int) ([]FeeSchedule, error) {
+	rows, err := db.Query("SELECT "+feeScheduleColumns+" FROM fee_schedules WHERE client_id = $1 "+
+		" ORDER BY method_type, transaction_type", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []FeeSchedule
+	for rows.Next() {
+		var s FeeSchedule
+		// a skipped schedule would hide a fee that is still charged
+		if err := scanFeeSchedule(rows, &s); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+
+	return schedules, rows.Err()
+}
+
+// DeleteFeeSchedule stop charging the fee of the schedule
+func (db *DB) DeleteFeeSchedule(id, scheduleID int) error {
+	r, err := db.Exec("DELETE FROM fee_schedules WHERE client_id = $1 AND id = $2", id, scheduleID)
+	if err != nil {
+		return err
+	}
+	if c, _ := r.RowsAffected(); c == 0 {
+		return ErrFeeNotFound
+	}
+
+	return nil
+}
+
+// PreviewFee quote the fee a cr/dr of amt with the method type would be charged on the e-Wallet,
+// a zero breakdown when no schedule applies
+func (db *DB) PreviewFee(id int, guid, transactionType, methodType string, amt Amount) (*FeeBreakdown, error) {
+	if transactionType != "cr" && transactionType != "dr" {
+		return nil, ErrInvalidFee
+	}
+	if amt <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	t := Transaction{ClientID: id, Address: guid, TransactionType: transactionType, MethodType: methodType}
+	if transactionType == "cr" {
+		t.CrAmount = amt
+	} else {
+		t.DrAmount = amt
+	}
+
+	f, err := quoteFee(db, &t)
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		f = &FeeBreakdown{Base: amt, Net: amt}
+	}
+
+	return f, nil
+}
+
+// quoteFee work out the fee of the cr/dr from the client schedule, nil when none applies
+func quoteFee(q querier, t *Transaction) (*FeeBreakdown, error) {
+	amt := t.Amount()
+	cur, err := walletCurrency(q, t.ClientID, t.Address, &t.Currency, amt)
+	if err != nil {
+		return nil, err
+	}
+
+	var s FeeSchedule
+	err = scanFeeSchedule(q.QueryRow("SELECT "+feeScheduleColumns+" FROM fee_schedules "+
+		" WHERE client_id = $1 AND method_type = $2 AND transaction_type = $3",
+		t.ClientID, t.MethodType, t.TransactionType), &s)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.quote(cur, t.TransactionType, amt)
+}
+
+// tier return the flat and percentage fee of amt, from the first tier it fits in
+// or the last tier, from the schedule itself when it has no tiers
+func (s *FeeSchedule) tier(amt Amount) (Amount, Rate) {
+	for i, tier := range s.Tiers {
+		if tier.UpTo == nil || amt <= *tier.UpTo || i == len(s.Tiers)-1 {
+			return tier.Flat, tier.Rate
+		}
+	}
+
+	return s.Flat, s.Rate
+}
+
+// quote work out the fee of a cr/dr of amt in the currency cur
+func (s *FeeSchedule) quote(cur *Currency, transactionType string, amt Amount) (*FeeBreakdown, error) {
+	flat, rate := s.tier(amt)
+	percentage, err := cur.Mul(amt, rate)
+	if err != nil {
+		return nil, err
+	}
+	f := FeeBreakdown{ScheduleID: s.ID, Base: amt, Flat: flat, Percentage: percentage, Netted: s.Netted}
+	fee := f.Flat + f.Percentage
+	if s.MinFee != nil && fee < *s.MinFee {
+		fee = *s.MinFee
+	}
+	if s.MaxFee != nil && fee > *s.MaxFee {
+		fee = *s.MaxFee
+	}
+	f.Fee = cur.Round(fee)
+	f.Net = amt + f.Fee
+	if transactionType == "cr" {
+		f.Net = amt - f.Fee
+	}
+	if f.Netted && f.Fee > amt {
+		// a netted fee can not take more than the credit
+		return nil, ErrInvalidFee
+	}
+
+	return &f, nil
+}
+
+// chargeFee post the linked fee dr of the posted t into the client fee account. A netted
+// fee was already taken off the credit by postTransaction. The fee must fit in the balance
+// left after t, the same as a debit.
+func chargeFee(tx *sql.Tx, t *Transaction) error {
+	if t.Fee == nil || t.Fee.Fee == 0 || t.Fee.Netted {
+		return nil
+	}
+	locked, err := lockedBonus(tx, t.ClientID, t.Address)
+	if err != nil {
+		return err
+	}
+	if !isBalanceEnoughForDebit(tx, t.ClientID, t.Address, t.Fee.Fee+locked) {
+		return ErrInsufficientBalance
+	}
+
+	fee := Transaction{
+		ClientID:        t.ClientID,
+		Address:         t.Address,
+		TransactionType: "dr",
+		Currency:        t.Currency,
+		DrAmount:        t.Fee.Fee,
+		MethodType:      MethodFee,
+		Particulars:     fmt.Sprintf("Fee for %s", t.ReferenceCode),
+		FeeOf:           t.ReferenceCode,
+		contra:          AccountFees,
+		keepBonus:       true,
+	}
+	if err = postTransaction(tx, &fee); err != nil {
+		return err
+	}
+	t.Fee.ReferenceCode = fee.ReferenceCode
+	_, err = tx.Exec("UPDATE transactions SET fee = $2 WHERE id = $1", t.ID, t.Fee)
+
+	return err
+}
+
+func (s *FeeSchedule) valid() bool {
+	if s.MethodType == "" || (s.TransactionType != "cr" && s.TransactionType != "dr") {
+		return false
+	}
+	if s.Netted && s.TransactionType != "cr" {
+		return false
+	}
+	if s.Flat < 0 || s.Rate < 0 || (s.MinFee != nil && *s.MinFee < 0) || (s.MaxFee != nil && *s.MaxFee < 0) {
+		return false
+	}
+	if s.MinFee != nil && s.MaxFee != nil && *s.MinFee > *s.MaxFee {
+		return false
+	}
+	for i, tier := range s.Tiers {
+		if tier.Flat < 0 || tier.Rate < 0 {
+			return false
+		}
+		if tier.UpTo == nil && i != len(s.Tiers)-1 {
+			return false
+		}
+		if i > 0 && tier.UpTo != nil && *tier.UpTo <= *s.Tiers[i-1].UpTo {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,131 @@
+package models
+
+import "testing"
+
+func amountPtr(s string) *Amount {
+	a := MustParseAmount(s)
+	return &a
+}
+
+func TestFeeScheduleTier(t *testing.T) {
+	tiered := FeeSchedule{
+		Flat: MustParseAmount("9"),
+		Tiers: FeeTiers{
+			{UpTo: amountPtr("100"), Flat: MustParseAmount("1")},
+			{UpTo: amountPtr("1000"), Rate: mustParseRate(t, "0.01")},
+			{Flat: MustParseAmount("5")},
+		},
+	}
+	capped := FeeSchedule{
+		Tiers: FeeTiers{
+			{UpTo: amountPtr("100"), Flat: MustParseAmount("1")},
+			{UpTo: amountPtr("200"), Flat: MustParseAmount("2")},
+		},
+	}
+	flat := FeeSchedule{Flat: MustParseAmount("3"), Rate: mustParseRate(t, "0.02")}
+
+	tests := []struct {
+		name string
+		s    FeeSchedule
+		amt  string
+		flat string
+		rate string
+	}{
+		{"first tier", tiered, "50", "1.0000", "0.00000000"},
+		{"tier bound is inclusive", tiered, "100", "1.0000", "0.00000000"},
+		{"just over the first tier", tiered, "100.0001", "0.0000", "0.01000000"},
+		{"second tier bound", tiered, "1000", "0.0000", "0.01000000"},
+		{"open last tier", tiered, "5000", "5.0000", "0.00000000"},
+		{"over a bounded last tier", capped, "500", "2.0000", "0.00000000"},
+		{"no tiers", flat, "500", "3.0000", "0.02000000"},
+	}
+
+	for _, tt := range tests {
+		f, p := tt.s.tier(MustParseAmount(tt.amt))
+		if f.String() != tt.flat || p.String() != tt.rate {
+			t.Errorf("%s: tier(%s) = %s, %s, want %s, %s", tt.name, tt.amt, f, p, tt.flat, tt.rate)
+		}
+	}
+}
+
+func TestFeeScheduleQuote(t *testing.T) {
+	php := &Currency{Code: "PHP", MinorUnits: 2, Rounding: RoundHalfEven}
+	base := FeeSchedule{ID: 7, Flat: MustParseAmount("1"), Rate: mustParseRate(t, "0.015")}
+	withMin := base
+	withMin.MinFee = amountPtr("5")
+	withMax := base
+	withMax.MaxFee = amountPtr("2")
+	small := FeeSchedule{Rate: mustParseRate(t, "0.0125")}
+	netted := FeeSchedule{Flat: MustParseAmount("150"), Netted: true}
+	nettedAll := FeeSchedule{Flat: MustParseAmount("100"), Netted: true}
+
+	tests := []struct {
+		name            string
+		s               FeeSchedule
+		transactionType string
+		amt             string
+		fee             string
+		net             string
+		err             bool
+	}{
+		{name: "debit adds the fee", s: base, transactionType: "dr", amt: "100", fee: "2.5000", net: "102.5000"},
+		{name: "credit takes the fee", s: base, transactionType: "cr", amt: "100", fee: "2.5000", net: "97.5000"},
+		{name: "minimum fee", s: withMin, transactionType: "dr", amt: "100", fee: "5.0000", net: "105.0000"},
+		{name: "maximum fee", s: withMax, transactionType: "dr", amt: "100", fee: "2.0000", net: "102.0000"},
+		{name: "currency rounding", s: small, transactionType: "dr", amt: "1", fee: "0.0100", net: "1.0100"},
+		{name: "netted fee over the credit", s: netted, transactionType: "cr", amt: "100", err: true},
+		{name: "netted fee equal to the credit", s: nettedAll, transactionType: "cr", amt: "100", fee: "100.0000", net: "0.0000"},
+	}
+
+	for _, tt := range tests {
+		f, err := tt.s.quote(php, tt.transactionType, MustParseAmount(tt.amt))
+		if tt.err {
+			if err != ErrInvalidFee {
+				t.Errorf("%s: error = %v, want ErrInvalidFee", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+			continue
+		}
+		if f.Fee.String() != tt.fee || f.Net.String() != tt.net || f.Base.String() != MustParseAmount(tt.amt).String() {
+			t.Errorf("%s: fee = %s, net = %s, want %s, %s", tt.name, f.Fee, f.Net, tt.fee, tt.net)
+		}
+		if f.ScheduleID != tt.s.ID || f.Netted != tt.s.Netted {
+			t.Errorf("%s: schedule = %d, netted = %t", tt.name, f.ScheduleID, f.Netted)
+		}
+	}
+}
+
+func TestFeeScheduleValid(t *testing.T) {
+	tests := []struct {
+		name string
+		s    FeeSchedule
+		want bool
+	}{
+		{"flat debit fee", FeeSchedule{MethodType: "withdraw", TransactionType: "dr", Flat: 100}, true},
+		{"netted credit fee", FeeSchedule{MethodType: "deposit", TransactionType: "cr", Netted: true}, true},
+		{"no method type", FeeSchedule{TransactionType: "dr"}, false},
+		{"unknown transaction type", FeeSchedule{MethodType: "withdraw", TransactionType: "xx"}, false},
+		{"netted debit fee", FeeSchedule{MethodType: "withdraw", TransactionType: "dr", Netted: true}, false},
+		{"negative flat", FeeSchedule{MethodType: "withdraw", TransactionType: "dr", Flat: -1}, false},
+		{"negative minimum", FeeSchedule{MethodType: "withdraw", TransactionType: "dr", MinFee: amountPtr("-1")}, false},
+		{"minimum over maximum", FeeSchedule{MethodType: "withdraw", TransactionType: "dr",
+			MinFee: amountPtr("5"), MaxFee: amountPtr("2")}, false},
+		{"ordered tiers", FeeSchedule{MethodType: "withdraw", TransactionType: "dr",
+			Tiers: FeeTiers{{UpTo: amountPtr("100")}, {UpTo: amountPtr("200")}, {}}}, true},
+		{"open tier before the last", FeeSchedule{MethodType: "withdraw", TransactionType: "dr",
+			Tiers: FeeTiers{{}, {UpTo: amountPtr("200")}}}, false},
+		{"unordered tiers", FeeSchedule{MethodType: "withdraw", TransactionType: "dr",
+			Tiers: FeeTiers{{UpTo: amountPtr("200")}, {UpTo: amountPtr("100")}}}, false},
+		{"negative tier", FeeSchedule{MethodType: "withdraw", TransactionType: "dr",
+			Tiers: FeeTiers{{Flat: -1}}}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.s.valid(); got != tt.want {
+			t.Errorf("%s: valid() = %t, want %t", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+var (
+	// ErrFXRateNotFound is returned when no rate is effective for the currency pair
+	ErrFXRateNotFound = errors.New("No exchange rate for the currency pair")
+	// ErrFXSameCurrency is returned when exchanging between wallets of the same currency
+	ErrFXSameCurrency = errors.New("e-Wallets have the same currency, use a transfer")
+	// ErrFXDifferentUser is returned when the two wallets do not belong to the same user
+	ErrFXDifferentUser = errors.New("e-Wallets must belong to the same user")
+	// ErrQuoteNotOpen is returned when executing an expired or already executed quote
+	ErrQuoteNotOpen = errors.New("Quote not found, expired or already executed")
+	// ErrInvalidFXRate is returned when a rate is not positive or the spread is not below 1
+	ErrInvalidFXRate = errors.New("Rate must be over zero and spread between 0 and 1")
+)
+
+// quote statuses
+const (
+	QuoteOpen     = "open"
+	QuoteExecuted = "executed"
+)
+
+// FXRate is an entry of the rate table, Rate is how many Quote for one Base
+type FXRate struct {
+	ID    int    `json:"id"`
+	Base  string `json:"base"`
+	Quote string `json:"quote"`
+	Rate  Rate   `json:"rate"`
+	// Spread is the fraction kept on each exchange, e.g. 0.005 for 0.5%
+	Spread        Rate      `json:"spread"`
+	EffectiveFrom time.Time `json:"effectiveFrom"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// FXQuote locks an exchange rate between two e-Wallets of a user until ExpiresAt
+type FXQuote struct {
+	QuoteCode           string `json:"quoteCode"`
+	ClientID            int    `json:"-"`
+	Source              string `json:"source"`
+	Destination         string `json:"destination"`
+	SourceCurrency      string `json:"sourceCurrency"`
+	DestinationCurrency string `json:"destinationCurrency"`
+	SourceAmount        Amount `json:"sourceAmount"`
+	DestinationAmount   Amount `json:"destinationAmount"`
+	// Rate is the table rate, AppliedRate is Rate less the spread
+	Rate        Rate         `json:"rate"`
+	Spread      Rate         `json:"spread"`
+	AppliedRate Rate         `json:"appliedRate"`
+	MethodType  string       `json:"methodType"`
+	Particulars string       `json:"particulars"`
+	Status      string       `json:"status"`
+	Debit       *Transaction `json:"debit,omitempty"`
+	Credit      *Transaction `json:"credit,omitempty"`
+	ExpiresAt   time.Time    `json:"expiresAt"`
+	CreatedAt   time.Time    `json:"createdAt"`
+}
+
+// CreateFXRate add a rate to the table, it replaces the previous rate of the pair from EffectiveFrom
+func (db *DB) CreateFXRate(r *FXRate) error {
+	if r.Rate <= 0 || r.Spread < 0 || r.Spread >= rateUnit {
+		return ErrInvalidFXRate
+	}
+	base, err := getCurrency(db, r.Base)
+	if err != nil {
+		return err
+	}
+	quote, err := getCurrency(db, r.Quote)
+	if err != nil {
+		return err
+	}
+	r.Base, r.Quote = base.Code, quote.Code
+	r.CreatedAt = time.Now().Local()
+	if r.EffectiveFrom.IsZero() {
+		r.EffectiveFrom = r.CreatedAt
+	}
+
+	return db.QueryRow("INSERT INTO fx_rates (base, quote, rate, spread, effective_from, created_at) "+
+		" VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;",
+		r.Base, r.Quote, r.Rate, r.Spread, r.EffectiveFrom, r.CreatedAt).Scan(&r.ID)
+}
+
+// GetAllFXRate return the rate table, latest first, optionally for one base and/or quote currency
+func (db *DB) GetAllFXRate(base, quote string) ([]FXRate, error) {
+	rows, err := db.Query("SELECT id, base, quote, rate, spread, effective_from, created_at FROM fx_rates "+
+		" WHERE ($1 = '' OR base = UPPER($1)) AND ($2 = '' OR quote = UPPER($2)) "+
+		" ORDER BY base, quote, effective_from DESC", base, quote)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []FXRate
+	for rows.Next() {
+		var r FXRate
+		err := rows.Scan(&r.ID, &r.Base, &r.Quote, &r.Rate, &r.Spread, &r.EffectiveFrom, &r.CreatedAt)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		rates = append(rates, r)
+	}
+
+	return rates, nil
+}
+
+// CreateFXQuote price the exchange of q.SourceAmount and lock the rate for ttl
+func (db *DB) CreateFXQuote(q *FXQuote, ttl time.Duration) error {
+	return createFXQuote(db, q, ttl)
+}
+
+// ExecuteFXQuote debit the source and credit the destination e-Wallet at the quoted rate
+// in one database transaction, a quote can only be executed once and before it expires
+func (db *DB) ExecuteFXQuote(id int, code string) (*FXQuote, error) {
+	var q FXQuote
+
+	err := db.withTx(func(tx *sql.Tx) error {
+		return executeFXQuote(tx, id, code, &q)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &q, nil
+}
+
+// Exchange quote and execute in one step at the current rate
+func (db *DB) Exchange(q *FXQuote) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		// executed right away, the lock only has to outlive this transaction
+		if err := createFXQuote(tx, q, time.Minute); err != nil {
+			return err
+		}
+
+		return executeFXQuote(tx, q.ClientID, q.QuoteCode, q)
+	})
+}
+
+func createFXQuote(qr querier, q *FXQuote, ttl time.Duration) error {
+	var srcUser, dstUser int
+	err := qr.QueryRow("SELECT user_id, currency FROM wallets WHERE client_id = $1 AND address = $2",
+		q.ClientID, q.Source).Scan(&srcUser, &q.SourceCurrency)
+	if err == sql.ErrNoRows {
+		return ErrWalletNotActive
+	}
+	if err != nil {
+		return err
+	}
+	err = qr.QueryRow("SELECT user_id, currency FROM wallets WHERE client_id = $1 AND address = $2",
+		q.ClientID, q.Destination).Scan(&dstUser, &q.DestinationCurrency)
+	if err == sql.ErrNoRows {
+		return ErrWalletNotActive
+	}
+	if err != nil {
+		return err
+	}
+	if srcUser != dstUser {
+		return ErrFXDifferentUser
+	}
+	if q.SourceCurrency == q.DestinationCurrency {
+		return ErrFXSameCurrency
+	}
+
+	src, err := getCurrency(qr, q.SourceCurrency)
+	if err != nil {
+		return err
+	}
+	if !src.IsValidAmount(q.SourceAmount) {
+		return ErrAmountPrecision
+	}
+	dst, err := getCurrency(qr, q.DestinationCurrency)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Local()
+	q.Rate, q.Spread, err = currentFXRate(qr, q.SourceCurrency, q.DestinationCurrency, now)
+	if err != nil {
+		return err
+	}
+	q.AppliedRate = q.Rate.Mul(rateUnit - q.Spread)
+	if q.DestinationAmount, err = dst.Mul(q.SourceAmount, q.AppliedRate); err != nil {
+		return err
+	}
+	if q.DestinationAmount <= 0 {
+		return ErrAmountPrecision
+	}
+
+	q.QuoteCode = "FXQ" + xid.New().String()
+	q.Status = QuoteOpen
+	q.CreatedAt = now
+	q.ExpiresAt = now.Add(ttl)
+	if q.MethodType == "" {
+		q.MethodType = "fx"
+	}
+
+	_, err = qr.Exec("INSERT INTO fx_quotes (quote_code, client_id, source, destination, source_currency, "+
+		" destination_currency, source_amount, destination_amount, rate, spread, applied_rate, method_type, "+
+		" particulars, status, expires_at, created_at) "+
+		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)",
+		q.QuoteCode, q.ClientID, q.Source, q.Destination, q.SourceCurrency, q.DestinationCurrency,
+		q.SourceAmount, q.DestinationAmount, q.Rate, q.Spread, q.AppliedRate, q.MethodType,
+		q.Particulars, q.Status, q.ExpiresAt, q.CreatedAt)
+
+	return err
+}
+
+func executeFXQuote(tx *sql.Tx, id int, code string, q *FXQuote) error {
+	err := tx.QueryRow("SELECT quote_code, client_id, source, destination, source_currency, destination_currency, "+
+		" source_amount, destination_amount, rate, spread, applied_rate, method_type, particulars, status, "+
+		" expires_at, created_at FROM fx_quotes WHERE client_id = $1 AND quote_code = $2 FOR UPDATE", id, code).Scan(
+		&q.QuoteCode, &q.ClientID, &q.Source, &q.Destination, &q.SourceCurrency, &q.DestinationCurrency,
+		&q.SourceAmount, &q.DestinationAmount, &q.Rate, &q.Spread, &q.AppliedRate, &q.MethodType, &q.Particulars,
+		&q.Status, &q.ExpiresAt, &q.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrQuoteNotOpen
+	}
+	if err != nil {
+		return err
+	}
+	if q.Status != QuoteOpen || !q.ExpiresAt.After(time.Now()) {
+		return ErrQuoteNotOpen
+	}
+
+	if err = lockWalletPair(tx, id, q.Source, q.Destination); err != nil {
+		return err
+	}
+	if !isWalletActive(tx, id, q.Source) || !isWalletActive(tx, id, q.Destination) {
+		return ErrWalletNotActive
+	}
+	// bonus money still being wagered stays in the source
+	locked, err := lockedBonus(tx, id, q.Source)
+	if err != nil {
+		return err
+	}
+	if !isBalanceEnoughForDebit(tx, id, q.Source, q.SourceAmount+locked) {
+		return ErrInsufficientBalance
+	}
+
+	particulars := q.Particulars
+	if particulars == "" {
+		particulars = "FX " + q.SourceCurrency + "/" + q.DestinationCurrency + " @ " + q.AppliedRate.String()
+	}
+	q.Debit = &Transaction{
+		ClientID:          id,
+		Address:           q.Source,
+		TransactionType:   "dr",
+		Currency:          q.SourceCurrency,
+		DrAmount:          q.SourceAmount,
+		MethodType:        q.MethodType,
+		Particulars:       particulars,
+		TransferReference: q.QuoteCode,
+		FXRate:            q.AppliedRate,
+		keepBonus:         true,
+	}
+	if err = postTransaction(tx, q.Debit); err != nil {
+		return err
+	}
+	q.Credit = &Transaction{
+		ClientID:          id,
+		Address:           q.Destination,
+		TransactionType:   "cr",
+		Currency:          q.DestinationCurrency,
+		CrAmount:          q.DestinationAmount,
+		MethodType:        q.MethodType,
+		Particulars:       particulars,
+		TransferReference: q.QuoteCode,
+		FXRate:            q.AppliedRate,
+	}
+	if err = postTransaction(tx, q.Credit); err != nil {
+		return err
+	}
+
+	q.Status = QuoteExecuted
+	_, err = tx.Exec("UPDATE fx_quotes SET status = $2 WHERE quote_code = $1", q.QuoteCode, q.Status)
+
+	return err
+}
+
+// currentFXRate return the rate and spread effective at for base to quote,
+// when only the opposite pair is stored its inverse is used
+func currentFXRate(q querier, base, quote string, at time.Time) (Rate, Rate, error) {
+	var rate, spread Rate
+	err := q.QueryRow("SELECT rate, spread FROM fx_rates WHERE base = $1 AND quote = $2 AND effective_from <= $3 "+
+		" ORDER BY effective_from DESC LIMIT 1", base, quote, at).Scan(&rate, &spread)
+	if err == nil {
+		return rate, spread, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, 0, err
+	}
+
+	err = q.QueryRow("SELECT rate, spread FROM fx_rates WHERE base = $1 AND quote = $2 AND effective_from <= $3 "+
+		" ORDER BY effective_from DESC LIMIT 1", quote, base, at).Scan(&rate, &spread)
+	if err == sql.ErrNoRows {
+		return 0, 0, ErrFXRateNotFound
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return rate.Inverse(), spread, nil
+}
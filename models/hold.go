@@ -0,0 +1,243 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+// ErrHoldNotActive is returned when capturing or voiding a hold that is not authorized anymore
+var ErrHoldNotActive = errors.New("Hold not found or no longer authorized")
+
+// ErrCaptureExceedsHold is returned when capturing more than the authorized amount
+var ErrCaptureExceedsHold = errors.New("Capture amount exceeds the hold amount")
+
+// Hold reserves part of the Wallet balance until it is captured, voided or expires
+type Hold struct {
+	ID             int          `json:"-"`
+	HoldCode       string       `json:"holdCode"`
+	ClientID       int          `json:"clientId"`
+	Address        string       `json:"address"`
+	Currency       string       `json:"currency"`
+	Amount         Amount       `json:"amount"`
+	CapturedAmount Amount       `json:"capturedAmount"`
+	MethodType     string       `json:"methodType"`
+	Particulars    string       `json:"particulars"`
+	Status         string       `json:"status"`
+	Transaction    *Transaction `json:"transaction,omitempty"`
+	ExpiresAt      time.Time    `json:"expiresAt"`
+	CreatedAt      time.Time    `json:"createdAt"`
+	UpdatedAt      time.Time    `json:"updatedAt"`
+}
+
+// hold statuses
+const (
+	HoldAuthorized = "authorized"
+	HoldCaptured   = "captured"
+	HoldVoided     = "voided"
+	HoldExpired    = "expired"
+)
+
+// holdColumns is the select list read by scanHold
+const holdColumns = "id, hold_code, client_id, address, currency, amount, captured_amount, method_type, particulars, " +
+	" status, expires_at, created_at, updated_at"
+
+func scanHold(r rowScanner, h *Hold) error {
+	return r.Scan(&h.ID, &h.HoldCode, &h.ClientID, &h.Address, &h.Currency, &h.Amount, &h.CapturedAmount, &h.MethodType,
+		&h.Particulars, &h.Status, &h.ExpiresAt, &h.CreatedAt, &h.UpdatedAt)
+}
+
+// AuthorizeHold reserve hold.Amount of the available balance for ttl
+func (db *DB) AuthorizeHold(hold *Hold, ttl time.Duration) error {
+	return db.withTx(func(tx *sql.Tx) error {
+		if err := lockWallet(tx, hold.ClientID, hold.Address); err != nil {
+			return err
+		}
+		_, err := walletCurrency(tx, hold.ClientID, hold.Address, &hold.Currency, hold.Amount)
+		if err != nil {
+			return err
+		}
+		// bonus money still being wagered can not be reserved
+		locked, err := lockedBonus(tx, hold.ClientID, hold.Address)
+		if err != nil {
+			return err
+		}
+		if !isBalanceEnoughForDebit(tx, hold.ClientID, hold.Address, hold.Amount+locked) {
+			return ErrInsufficientBalance
+		}
+		// the debit limits apply when the funds are reserved, the capture is not checked again
+		err = checkLimits(tx, &Transaction{ClientID: hold.ClientID, Address: hold.Address, TransactionType: "dr",
+			DrAmount: hold.Amount, MethodType: hold.MethodType})
+		if err != nil {
+			return err
+		}
+
+		hold.HoldCode = "HLD" + xid.New().String()
+		hold.Status = HoldAuthorized
+		hold.CreatedAt = time.Now().Local()
+		hold.UpdatedAt = hold.CreatedAt
+		hold.ExpiresAt = hold.CreatedAt.Add(ttl)
+
+		err = tx.QueryRow("INSERT INTO holds (hold_code, client_id, address, currency, amount, captured_amount, "+
+			" method_type, particulars, status, expires_at, created_at, updated_at) "+
+			" VALUES ($1, $2, $3, $4, $5, 0, $6, $7, $8, $9, $10, $11) RETURNING id;",
+			hold.HoldCode, hold.ClientID, hold.Address, hold.Currency, hold.Amount, hold.MethodType, hold.Particulars,
+			hold.Status, hold.ExpiresAt, hold.CreatedAt, hold.UpdatedAt).Scan(&hold.ID)
+		if err != nil {
+			return err
+		}
+
+		return updateHeldBalance(tx, hold.ClientID, hold.Address, hold.Amount)
+	})
+}
+
+// CaptureHold debit amt of the hold and release the rest, zero amt captures the full hold
+func (db *DB) CaptureHold(id int, guid, code string, amt Amount, particulars string) (*Hold, error) {
+	var hold Hold
+
+	err := db.withTx(func(tx *sql.Tx) error {
+		err := lockActiveHold(tx, id, guid, code, &hold)
+		if err != nil {
+			return err
+		}
+		if amt == 0 {
+			amt = hold.Amount
+		}
+		if amt > hold.Amount {
+			return ErrCaptureExceedsHold
+		}
+		if err = lockWallet(tx, id, guid); err != nil {
+			return err
+		}
+		// release the whole reservation, the captured part is then debited from the freed balance
+		if err = updateHeldBalance(tx, id, guid, -hold.Amount); err != nil {
+			return err
+		}
+		if particulars == "" {
+			particulars = hold.Particulars
+		}
+		hold.Transaction = &Transaction{
+			ClientID:        id,
+			Address:         guid,
+			TransactionType: "dr",
+			Currency:        hold.Currency,
+			DrAmount:        amt,
+			MethodType:      hold.MethodType,
+			Particulars:     particulars,
+			noLimits:        true,
+			keepBonus:       true,
+		}
+		if err = postTransaction(tx, hold.Transaction); err != nil {
+			return err
+		}
+
+		hold.CapturedAmount = amt
+
+		return setHoldStatus(tx, &hold, HoldCaptured)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// VoidHold release the hold without debiting the Wallet
+func (db *DB) VoidHold(id int, guid, code string) (*Hold, error) {
+	var hold Hold
+
+	err := db.withTx(func(tx *sql.Tx) error {
+		err := lockActiveHold(tx, id, guid, code, &hold)
+		if err != nil {
+			return err
+		}
+		if err = lockWallet(tx, id, guid); err != nil {
+			return err
+		}
+		if err = updateHeldBalance(tx, id, guid, -hold.Amount); err != nil {
+			return err
+		}
+
+		return setHoldStatus(tx, &hold, HoldVoided)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &hold, nil
+}
+
+// GetAllHoldByIDGUID return the holds of the Client e-Wallet address, latest first
+func (db *DB) GetAllHoldByIDGUID(id int, guid string) ([]Hold, error) {
+	rows, err := db.Query("SELECT "+holdColumns+" FROM holds WHERE client_id = $1 AND address = $2 "+
+		" ORDER BY created_at DESC", id, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holds []Hold
+	for rows.Next() {
+		var h Hold
+		err := scanHold(rows, &h)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		holds = append(holds, h)
+	}
+
+	return holds, nil
+}
+
+// ExpireHolds release every authorized hold past its expiry, returns how many Wallets were released
+func (db *DB) ExpireHolds() (int64, error) {
+	r, err := db.Exec("WITH expired AS ( "+
+		"   UPDATE holds SET status = $1, updated_at = $2 "+
+		"   WHERE status = $3 AND expires_at <= $2 RETURNING client_id, address, amount) "+
+		" UPDATE wallets w SET held_balance = w.held_balance - e.total "+
+		" FROM (SELECT client_id, address, SUM(amount) AS total FROM expired GROUP BY client_id, address) e "+
+		" WHERE w.client_id = e.client_id AND w.address = e.address",
+		HoldExpired, time.Now().Local(), HoldAuthorized)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.RowsAffected()
+}
+
+// lockActiveHold read and lock an authorized, unexpired hold
+func lockActiveHold(tx *sql.Tx, id int, guid, code string, h *Hold) error {
+	err := scanHold(tx.QueryRow("SELECT "+holdColumns+" FROM holds "+
+		" WHERE client_id = $1 AND address = $2 AND hold_code = $3 FOR UPDATE", id, guid, code), h)
+	if err == sql.ErrNoRows {
+		return ErrHoldNotActive
+	}
+	if err != nil {
+		return err
+	}
+	if h.Status != HoldAuthorized || !h.ExpiresAt.After(time.Now()) {
+		return ErrHoldNotActive
+	}
+
+	return nil
+}
+
+func setHoldStatus(tx *sql.Tx, h *Hold, status string) error {
+	h.Status = status
+	h.UpdatedAt = time.Now().Local()
+	_, err := tx.Exec("UPDATE holds SET status = $2, captured_amount = $3, updated_at = $4 WHERE id = $1",
+		h.ID, h.Status, h.CapturedAmount, h.UpdatedAt)
+
+	return err
+}
+
+func updateHeldBalance(q querier, id int, guid string, amt Amount) error {
+	_, err := q.Exec("UPDATE wallets SET held_balance = held_balance + $3 WHERE client_id = $1 AND address = $2",
+		id, guid, amt)
+
+	return err
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrIdempotencyConflict is returned when an idempotency key is reused with a different request
+	ErrIdempotencyConflict = errors.New("Idempotency key already used with a different request")
+	// ErrReservedIdempotencyKey is returned for a client key in the namespace of the scheduler keys
+	ErrReservedIdempotencyKey = errors.New("Idempotency keys starting with schedule: are reserved")
+)
+
+// scheduleKeyPrefix starts the idempotency keys of the scheduled runs, clients can not use it
+const scheduleKeyPrefix = "schedule:"
+
+// checkClientKey refuse a client idempotency key that could claim a scheduled run
+func checkClientKey(key string) error {
+	if strings.HasPrefix(key, scheduleKeyPrefix) {
+		return ErrReservedIdempotencyKey
+	}
+
+	return nil
+}
+
+// requestHash fingerprint the fields of a posting request that must match on replay
+func requestHash(t *Transaction) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s|%s|%s|%s|%s|%s|%s|%s", t.TransactionType, t.Address, t.Currency, t.CrAmount, t.DrAmount,
+		t.MethodType, t.Particulars, t.ExternalReference)
+	// only hashed when set so keys claimed before buckets still match
+	if t.Bucket != "" {
+		fmt.Fprintf(h, "|%s", t.Bucket)
+	}
+	if t.ExpiresAt != nil {
+		fmt.Fprintf(h, "|%s", t.ExpiresAt.UTC().Format(time.RFC3339Nano))
+	}
+	if t.grantTerms != "" {
+		fmt.Fprintf(h, "|%s", t.grantTerms)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// claimIdempotencyKey reserve key for the client inside tx. When the key was already
+// used by the same request the original transaction is returned, a different request
+// gets ErrIdempotencyConflict. An empty key disables the check.
+func claimIdempotencyKey(tx *sql.Tx, t *Transaction, key string) (*Transaction, error) {
+	if key == "" {
+		return nil, nil
+	}
+
+	hash := requestHash(t)
+	// a concurrent request with the same key waits here until the first one commits
+	r, err := tx.Exec("INSERT INTO idempotency_keys (client_id, idempotency_key, request_hash, created_at) "+
+		" VALUES ($1, $2, $3, $4) ON CONFLICT (client_id, idempotency_key) DO NOTHING;",
+		t.ClientID, key, hash, time.Now().Local())
+	if err != nil {
+		return nil, err
+	}
+	if c, _ := r.RowsAffected(); c == 1 {
+		return nil, nil
+	}
+
+	var storedHash string
+	var transactionID int
+	err = tx.QueryRow("SELECT request_hash, transaction_id FROM idempotency_keys "+
+		" WHERE client_id = $1 AND idempotency_key = $2", t.ClientID, key).Scan(&storedHash, &transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if storedHash != hash {
+		return nil, ErrIdempotencyConflict
+	}
+
+	return getTransactionByID(tx, transactionID)
+}
+
+// saveIdempotencyKey link the claimed key to the posted transaction
+func saveIdempotencyKey(tx *sql.Tx, t *Transaction, key string) error {
+	if key == "" {
+		return nil
+	}
+	_, err := tx.Exec("UPDATE idempotency_keys SET transaction_id = $3 WHERE client_id = $1 AND idempotency_key = $2",
+		t.ClientID, key, t.ID)
+
+	return err
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrUnbalancedEntry is returned when the postings of a journal entry do not sum to zero
+var ErrUnbalancedEntry = errors.New("Journal entry postings do not sum to zero")
+
+// system accounts kept per client and currency
+const (
+	// AccountClientFloat is the client money the e-Wallets are funded from and paid out to
+	AccountClientFloat = "client_float"
+	// AccountFees collects the fees charged to e-Wallets
+	AccountFees = "fees"
+)
+
+// account kinds
+const (
+	AccountKindWallet = "wallet"
+	AccountKindSystem = "system"
+)
+
+// Account is a ledger account, every e-Wallet has one and the client has the system accounts.
+// A positive posting increases the account, the postings of an entry always sum to zero.
+type Account struct {
+	ID       int    `json:"-"`
+	ClientID int    `json:"clientId"`
+	Code     string `json:"code"`
+	Kind     string `json:"kind"`
+	Address  string `json:"address,omitempty"`
+	Currency string `json:"currency"`
+	// Balance is the sum of the account postings
+	Balance Amount `json:"balance"`
+}
+
+// Posting is one leg of a journal entry
+type Posting struct {
+	AccountCode string `json:"accountCode"`
+	Address     string `json:"address,omitempty"`
+	Currency    string `json:"currency"`
+	Amount      Amount `json:"amount"`
+}
+
+// JournalEntry is a balanced set of postings, usually the ledger side of a Transaction
+type JournalEntry struct {
+	ID            int       `json:"-"`
+	ClientID      int       `json:"clientId"`
+	TransactionID int       `json:"-"`
+	ReferenceCode string    `json:"referenceCode"`
+	Description   string    `json:"description"`
+	Postings      []Posting `json:"postings"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// WalletLedger compares the cached e-Wallet balance with the sum of its account postings
+type WalletLedger struct {
+	Address       string `json:"address"`
+	Currency      string `json:"currency"`
+	CachedBalance Amount `json:"cachedBalance"`
+	PostedBalance Amount `json:"postedBalance"`
+	Balanced      bool   `json:"balanced"`
+}
+
+// walletAccountCode return the ledger account code of an e-Wallet
+func walletAccountCode(guid string) string {
+	return "wallet:" + guid
+}
+
+// GetAllAccount return the ledger accounts of the client with their posted balance
+func (db *DB) GetAllAccount(id int) ([]Account, error) {
+	rows, err := db.Query("SELECT a.id, a.client_id, a.code, a.kind, a.address, a.currency, COALESCE(SUM(p.amount), 0) "+
+		" FROM accounts a LEFT JOIN postings p ON p.account_id = a.id "+
+		" WHERE a.client_id = $1 GROUP BY a.id ORDER BY a.kind DESC, a.code, a.currency", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accounts []Account
+	for rows.Next() {
+		var a Account
+		err := rows.Scan(&a.ID, &a.ClientID, &a.Code, &a.Kind, &a.Address, &a.Currency, &a.Balance)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		accounts = append(accounts, a)
+	}
+
+	return accounts, nil
+}
+
+// GetWalletLedger prove the e-Wallet balance from its postings
+func (db *DB) GetWalletLedger(id int, guid string) (*WalletLedger, error) {
+	l := WalletLedger{Address: guid}
+	err := db.QueryRow("SELECT w.currency, w.balance, COALESCE(SUM(p.amount), 0) FROM wallets w "+
+		" LEFT JOIN accounts a ON a.client_id = w.client_id AND a.code = $3 AND a.currency = w.currency "+
+		" LEFT JOIN postings p ON p.account_id = a.id "+
+		" WHERE w.client_id = $1 AND w.address = $2 GROUP BY w.currency, w.balance",
+		id, guid, walletAccountCode(guid)).Scan(&l.Currency, &l.CachedBalance, &l.PostedBalance)
+	if err == sql.ErrNoRows {
+		return nil, ErrWalletNotActive
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.Balanced = l.CachedBalance == l.PostedBalance
+
+	return &l, nil
+}
+
+// journalTransaction post the ledger entry of a cr/dr: the e-Wallet account moves by the
+// amount and the contra account (client float unless set) by the opposite
+func journalTransaction(tx *sql.Tx, t *Transaction) error {
+	amt := t.CrAmount - t.DrAmount
+	contra := t.contra
+	if contra == "" {
+		contra = AccountClientFloat
+	}
+
+	postings := []Posting{
+		{AccountCode: walletAccountCode(t.Address), Address: t.Address, Currency: t.Currency, Amount: amt},
+		{AccountCode: contra, Currency: t.Currency, Amount: -amt},
+	}
+	// a fee netted from a credit comes from the contra account into the fee account
+	if t.Fee != nil && t.Fee.Netted && t.Fee.Fee != 0 {
+		postings[1].Amount -= t.Fee.Fee
+		postings = append(postings, Posting{AccountCode: AccountFees, Currency: t.Currency, Amount: t.Fee.Fee})
+	}
+
+	return postJournal(tx, &JournalEntry{
+		ClientID:      t.ClientID,
+		TransactionID: t.ID,
+		ReferenceCode: t.ReferenceCode,
+		Description:   t.Particulars,
+		Postings:      postings,
+	})
+}
+
+// postJournal check the entry sums to zero in every currency and write it with its postings
+func postJournal(tx *sql.Tx, e *JournalEntry) error {
+	sums := map[string]Amount{}
+	for _, p := range e.Postings {
+		sums[p.Currency] += p.Amount
+	}
+	for _, sum := range sums {
+		if sum != 0 {
+			return ErrUnbalancedEntry
+		}
+	}
+
+	e.CreatedAt = time.Now().Local()
+	var transactionID interface{}
+	if e.TransactionID != 0 {
+		transactionID = e.TransactionID
+	}
+	err := tx.QueryRow("INSERT INTO journal_entries (client_id, transaction_id, reference_code, description, created_at) "+
+		" VALUES ($1, $2, $3, $4, $5) RETURNING id;",
+		e.ClientID, transactionID, e.ReferenceCode, e.Description, e.CreatedAt).Scan(&e.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range e.Postings {
+		accountID, err := ensureAccount(tx, e.ClientID, p)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("INSERT INTO postings (journal_entry_id, account_id, currency, amount) VALUES ($1, $2, $3, $4)",
+			e.ID, accountID, p.Currency, p.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureAccount return the id of the posting account, creating it on first use
+func ensureAccount(tx *sql.Tx, id int, p Posting) (int, error) {
+	kind := AccountKindSystem
+	if p.Address != "" {
+		kind = AccountKindWallet
+	}
+
+	var accountID int
+	err := tx.QueryRow("INSERT INTO accounts (client_id, code, kind, address, currency, created_at) "+
+		" VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (client_id, code, currency) DO NOTHING RETURNING id;",
+		id, p.AccountCode, kind, p.Address, p.Currency, time.Now().Local()).Scan(&accountID)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow("SELECT id FROM accounts WHERE client_id = $1 AND code = $2 AND currency = $3",
+			id, p.AccountCode, p.Currency).Scan(&accountID)
+	}
+
+	return accountID, err
+}
@@ -0,0 +1,344 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrInvalidLimit is returned when a limit has an unknown scope, no scope value or a negative value
+var ErrInvalidLimit = errors.New("Invalid limit scope or value")
+
+// limit scopes, a wallet limit overrides the fund type one which overrides the client one
+const (
+	LimitScopeClient   = "client"
+	LimitScopeFundType = "fund_type"
+	LimitScopeWallet   = "wallet"
+)
+
+// LimitExceeded is the machine readable code of a LimitError
+const LimitExceeded = "LIMIT_EXCEEDED"
+
+// LimitValues are the configurable limits, nil means no limit
+type LimitValues struct {
+	MaxBalance   *Amount `json:"maxBalance"`
+	MaxCredit    *Amount `json:"maxCredit"`
+	MaxDebit     *Amount `json:"maxDebit"`
+	DailyDebit   *Amount `json:"dailyDebit"`
+	WeeklyDebit  *Amount `json:"weeklyDebit"`
+	MonthlyDebit *Amount `json:"monthlyDebit"`
+	DailyCount   *int    `json:"dailyCount"`
+	WeeklyCount  *int    `json:"weeklyCount"`
+	MonthlyCount *int    `json:"monthlyCount"`
+}
+
+// Limit is a set of limits for a client, a fund type or a single e-Wallet
+type Limit struct {
+	ID       int    `json:"id"`
+	ClientID int    `json:"-"`
+	Scope    string `json:"scope"`
+	// ScopeValue is the fund type or the e-Wallet address, empty for the client scope
+	ScopeValue string `json:"scopeValue"`
+	LimitValues
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Headroom is what an e-Wallet can still do under its effective limits
+type Headroom struct {
+	Address   string      `json:"address"`
+	Currency  string      `json:"currency"`
+	Balance   Amount      `json:"balance"`
+	Limits    LimitValues `json:"limits"`
+	Remaining LimitValues `json:"remaining"`
+}
+
+// LimitError is returned when a posting would break a limit
+type LimitError struct {
+	Code      string      `json:"code"`
+	Limit     string      `json:"limit"`
+	Max       interface{} `json:"max"`
+	Used      interface{} `json:"used"`
+	Requested interface{} `json:"requested"`
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("Limit exceeded: %s", e.Limit)
+}
+
+// limitUsage is the e-Wallet activity counted against the period limits
+type limitUsage struct {
+	balance                               Amount
+	dailyDebit, weeklyDebit, monthlyDebit Amount
+	dailyCount, weeklyCount, monthlyCount int
+}
+
+// limitColumns is the select list read by scanLimit
+const limitColumns = "id, client_id, scope, scope_value, max_balance, max_credit, max_debit, daily_debit, weekly_debit, " +
+	" monthly_debit, daily_count, weekly_count, monthly_count, created_at, updated_at"
+
+func scanLimit(r rowScanner, l *Limit) error {
+	return r.Scan(&l.ID, &l.ClientID, &l.Scope, &l.ScopeValue, &l.MaxBalance, &l.MaxCredit, &l.MaxDebit, &l.DailyDebit,
+		&l.WeeklyDebit, &l.MonthlyDebit, &l.DailyCount, &l.WeeklyCount, &l.MonthlyCount, &l.CreatedAt, &l.UpdatedAt)
+}
+
+// SetLimit create or replace the limits of the scope
+func (db *DB) SetLimit(l *Limit) error {
+	switch l.Scope {
+	case LimitScopeClient:
+		l.ScopeValue = ""
+	case LimitScopeFundType, LimitScopeWallet:
+		if l.ScopeValue == "" {
+			return ErrInvalidLimit
+		}
+	default:
+		return ErrInvalidLimit
+	}
+	for _, a := range []*Amount{l.MaxBalance, l.MaxCredit, l.MaxDebit, l.DailyDebit, l.WeeklyDebit, l.MonthlyDebit} {
+		if a != nil && *a < 0 {
+			return ErrInvalidLimit
+		}
+	}
+	for _, c := range []*int{l.DailyCount, l.WeeklyCount, l.MonthlyCount} {
+		if c != nil && *c < 0 {
+			return ErrInvalidLimit
+		}
+	}
+
+	now := time.Now().Local()
+	return scanLimit(db.QueryRow("INSERT INTO limits (client_id, scope, scope_value, max_balance, max_credit, max_debit, "+
+		" daily_debit, weekly_debit, monthly_debit, daily_count, weekly_count, monthly_count, created_at, updated_at) "+
+		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $13) "+
+		" ON CONFLICT (client_id, scope, scope_value) DO UPDATE SET max_balance = $4, max_credit = $5, max_debit = $6, "+
+		" daily_debit = $7, weekly_debit = $8, monthly_debit = $9, daily_count = $10, weekly_count = $11, "+
+		" monthly_count = $12, updated_at = $13 RETURNING "+limitColumns,
+		l.ClientID, l.Scope, l.ScopeValue, l.MaxBalance, l.MaxCredit, l.MaxDebit, l.DailyDebit, l.WeeklyDebit,
+		l.MonthlyDebit, l.DailyCount, l.WeeklyCount, l.MonthlyCount, now), l)
+}
+
+// GetAllLimit return the limits configured by the client
+func (db *DB) GetAllLimit(id int) ([]Limit, error) {
+	rows, err := db.Query("SELECT "+limitColumns+" FROM limits WHERE client_id = $1 ORDER BY scope, scope_value", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var limits []Limit
+	for rows.Next() {
+		var l Limit
+		err := scanLimit(rows, &l)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		limits = append(limits, l)
+	}
+
+	return limits, nil
+}
+
+// GetHeadroom return the effective limits of the e-Wallet and what is left of each
+func (db *DB) GetHeadroom(id int, guid string) (*Headroom, error) {
+	h := Headroom{Address: guid}
+	err := db.QueryRow("SELECT currency FROM wallets WHERE client_id = $1 AND address = $2", id, guid).Scan(&h.Currency)
+	if err == sql.ErrNoRows {
+		return nil, ErrWalletNotActive
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h.Limits, err = effectiveLimits(db, id, guid)
+	if err != nil {
+		return nil, err
+	}
+	u, err := walletUsage(db, id, guid)
+	if err != nil {
+		return nil, err
+	}
+	h.Balance = u.balance
+
+	l := h.Limits
+	h.Remaining = LimitValues{
+		MaxBalance:   remainingAmount(l.MaxBalance, u.balance),
+		MaxCredit:    remainingAmount(l.MaxCredit, 0),
+		MaxDebit:     remainingAmount(l.MaxDebit, 0),
+		DailyDebit:   remainingAmount(l.DailyDebit, u.dailyDebit),
+		WeeklyDebit:  remainingAmount(l.WeeklyDebit, u.weeklyDebit),
+		MonthlyDebit: remainingAmount(l.MonthlyDebit, u.monthlyDebit),
+		DailyCount:   remainingCount(l.DailyCount, u.dailyCount),
+		WeeklyCount:  remainingCount(l.WeeklyCount, u.weeklyCount),
+		MonthlyCount: remainingCount(l.MonthlyCount, u.monthlyCount),
+	}
+
+	return &h, nil
+}
+
+// checkLimits refuse the cr/dr when it breaks an effective limit of the Wallet. A fee dr counts
+// towards the debit amounts but not the transaction counts. The caller must hold the Wallet row lock.
+func checkLimits(q querier, t *Transaction) error {
+	l, err := effectiveLimits(q, t.ClientID, t.Address)
+	if err != nil {
+		return err
+	}
+	u, err := walletUsage(q, t.ClientID, t.Address)
+	if err != nil {
+		return err
+	}
+
+	if t.TransactionType == "cr" {
+		if err := overAmount("maxCredit", l.MaxCredit, 0, t.CrAmount); err != nil {
+			return err
+		}
+		if err := overAmount("maxBalance", l.MaxBalance, u.balance, t.CrAmount); err != nil {
+			return err
+		}
+	} else {
+		if err := overAmount("maxDebit", l.MaxDebit, 0, t.DrAmount); err != nil {
+			return err
+		}
+		if err := overAmount("dailyDebit", l.DailyDebit, u.dailyDebit, t.DrAmount); err != nil {
+			return err
+		}
+		if err := overAmount("weeklyDebit", l.WeeklyDebit, u.weeklyDebit, t.DrAmount); err != nil {
+			return err
+		}
+		if err := overAmount("monthlyDebit", l.MonthlyDebit, u.monthlyDebit, t.DrAmount); err != nil {
+			return err
+		}
+	}
+	if t.FeeOf != "" {
+		return nil
+	}
+	if err := overCount("dailyCount", l.DailyCount, u.dailyCount); err != nil {
+		return err
+	}
+	if err := overCount("weeklyCount", l.WeeklyCount, u.weeklyCount); err != nil {
+		return err
+	}
+
+	return overCount("monthlyCount", l.MonthlyCount, u.monthlyCount)
+}
+
+// effectiveLimits merge the client, fund type and wallet limits of the e-Wallet, the most specific wins
+func effectiveLimits(q querier, id int, guid string) (LimitValues, error) {
+	var values LimitValues
+	rows, err := q.Query("SELECT "+limitColumns+" FROM limits l "+
+		" WHERE l.client_id = $1 AND ((l.scope = $3 AND l.scope_value = '') "+
+		"   OR (l.scope = $4 AND l.scope_value = (SELECT fund_type FROM wallets WHERE client_id = $1 AND address = $2)) "+
+		"   OR (l.scope = $5 AND l.scope_value = $2)) "+
+		" ORDER BY CASE l.scope WHEN $3 THEN 0 WHEN $4 THEN 1 ELSE 2 END",
+		id, guid, LimitScopeClient, LimitScopeFundType, LimitScopeWallet)
+	if err != nil {
+		return values, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l Limit
+		if err := scanLimit(rows, &l); err != nil {
+			return values, err
+		}
+		values.override(l.LimitValues)
+	}
+
+	return values, rows.Err()
+}
+
+// override replace the limits that are set in o
+func (v *LimitValues) override(o LimitValues) {
+	for _, f := range []struct{ dst, src **Amount }{
+		{&v.MaxBalance, &o.MaxBalance}, {&v.MaxCredit, &o.MaxCredit}, {&v.MaxDebit, &o.MaxDebit},
+		{&v.DailyDebit, &o.DailyDebit}, {&v.WeeklyDebit, &o.WeeklyDebit}, {&v.MonthlyDebit, &o.MonthlyDebit},
+	} {
+		if *f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	for _, f := range []struct{ dst, src **int }{
+		{&v.DailyCount, &o.DailyCount}, {&v.WeeklyCount, &o.WeeklyCount}, {&v.MonthlyCount, &o.MonthlyCount},
+	} {
+		if *f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+}
+
+// walletUsage read the balance and the debits and transaction counts of the current day, week and month,
+// fee rows are not counted as transactions and reversals are left out
+func walletUsage(q querier, id int, guid string) (limitUsage, error) {
+	var u limitUsage
+	now := time.Now().Local()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	// weeks start on Monday
+	week := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	since := month
+	if week.Before(since) {
+		since = week
+	}
+
+	err := q.QueryRow("SELECT balance FROM wallets WHERE client_id = $1 AND address = $2", id, guid).Scan(&u.balance)
+	if err == sql.ErrNoRows {
+		return u, ErrWalletNotActive
+	}
+	if err != nil {
+		return u, err
+	}
+
+	err = q.QueryRow("SELECT "+
+		" COALESCE(SUM(dr_amount) FILTER (WHERE transaction_at >= $3), 0), "+
+		" COALESCE(SUM(dr_amount) FILTER (WHERE transaction_at >= $4), 0), "+
+		" COALESCE(SUM(dr_amount) FILTER (WHERE transaction_at >= $5), 0), "+
+		" count(*) FILTER (WHERE transaction_at >= $3 AND fee_of = ''), "+
+		" count(*) FILTER (WHERE transaction_at >= $4 AND fee_of = ''), "+
+		" count(*) FILTER (WHERE transaction_at >= $5 AND fee_of = '') "+
+		" FROM transactions WHERE client_id = $1 AND address = $2 AND transaction_at >= $6 AND reversal_of = ''",
+		id, guid, day, week, month, since).Scan(&u.dailyDebit, &u.weeklyDebit, &u.monthlyDebit,
+		&u.dailyCount, &u.weeklyCount, &u.monthlyCount)
+
+	return u, err
+}
+
+func overAmount(name string, max *Amount, used, amt Amount) error {
+	if max == nil || used+amt <= *max {
+		return nil
+	}
+
+	return &LimitError{Code: LimitExceeded, Limit: name, Max: *max, Used: used, Requested: amt}
+}
+
+func overCount(name string, max *int, used int) error {
+	if max == nil || used+1 <= *max {
+		return nil
+	}
+
+	return &LimitError{Code: LimitExceeded, Limit: name, Max: *max, Used: used, Requested: 1}
+}
+
+func remainingAmount(max *Amount, used Amount) *Amount {
+	if max == nil {
+		return nil
+	}
+	r := *max - used
+	if r < 0 {
+		r = 0
+	}
+
+	return &r
+}
+
+func remainingCount(max *int, used int) *int {
+	if max == nil {
+		return nil
+	}
+	r := *max - used
+	if r < 0 {
+		r = 0
+	}
+
+	return &r
+}
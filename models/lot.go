@@ -0,0 +1,220 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrInvalidExpiry is returned for an expiry on a debit or an expiry that already passed
+var ErrInvalidExpiry = errors.New("Expiry only applies to a credit and must be in the future")
+
+// MethodExpiry is the method type of the debit posted when a credit lot expires
+const MethodExpiry = "expiry"
+
+// lot statuses
+const (
+	LotOpen    = "open"
+	LotExpired = "expired"
+)
+
+// ExpiringAmount is what is left of the e-Wallet credits lapsing on a day
+type ExpiringAmount struct {
+	Date   string `json:"date"`
+	Amount Amount `json:"amount"`
+}
+
+// applyLots keep the credit lots of the e-Wallet: an expiring credit opens a lot per bucket,
+// a debit uses up the lots of the buckets it drew from, soonest expiry first
+func applyLots(tx *sql.Tx, t *Transaction) error {
+	if t.ExpiresAt != nil && (t.TransactionType != "cr" || !t.ExpiresAt.After(time.Now())) {
+		return ErrInvalidExpiry
+	}
+
+	if t.TransactionType == "cr" {
+		if t.ExpiresAt == nil {
+			return nil
+		}
+		for _, b := range t.Buckets {
+			_, err := tx.Exec("INSERT INTO credit_lots (client_id, address, reference_code, bucket, amount, remaining, "+
+				" expires_at, status, created_at) VALUES ($1, $2, $3, $4, $5, $5, $6, $7, $8)",
+				t.ClientID, t.Address, t.ReferenceCode, b.Bucket, b.Amount, *t.ExpiresAt, LotOpen, t.TransactionAt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, b := range t.Buckets {
+		if err := consumeLots(tx, t, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// consumeLots take the bucket part of the debit off the open lots. The reversal of an expiring
+// credit takes it off its own lot first, an expiry only off the lapsed lot.
+func consumeLots(tx *sql.Tx, t *Transaction, b BucketAmount) error {
+	rows, err := tx.Query("SELECT id, remaining FROM credit_lots "+
+		" WHERE client_id = $1 AND address = $2 AND bucket = $3 AND status = $4 AND remaining > 0 "+
+		" AND ($5 = 0 OR id = $5) "+
+		" ORDER BY reference_code = $6 DESC, expires_at, id FOR UPDATE",
+		t.ClientID, t.Address, b.Bucket, LotOpen, t.lot, t.ReversalOf)
+	if err != nil {
+		return err
+	}
+
+	type lotUse struct {
+		id  int
+		amt Amount
+	}
+	var uses []lotUse
+	left := b.Amount
+	for rows.Next() && left > 0 {
+		var u lotUse
+		var remaining Amount
+		if err := rows.Scan(&u.id, &remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		u.amt = remaining
+		if u.amt > left {
+			u.amt = left
+		}
+		left -= u.amt
+		uses = append(uses, u)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, u := range uses {
+		_, err := tx.Exec("UPDATE credit_lots SET remaining = remaining - $2 WHERE id = $1", u.id, u.amt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExpireCredits post an expiry dr for every lot past its expiry with money left,
+// returns how many lots were expired
+func (db *DB) ExpireCredits() (int, error) {
+	rows, err := db.Query("SELECT id FROM credit_lots WHERE status = $1 AND expires_at <= $2 ORDER BY expires_at, id",
+		LotOpen, time.Now().Local())
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, id := range ids {
+		// one transaction per lot so a failing wallet does not hold back the others
+		err := db.withTx(func(tx *sql.Tx) error {
+			return expireLot(tx, id)
+		})
+		if err != nil {
+			log.Println("Expire credit lot ", id, ": ", err)
+			continue
+		}
+		expired++
+	}
+
+	return expired, nil
+}
+
+// expireLot debit what is left of the lot and close it
+func expireLot(tx *sql.Tx, id int) error {
+	var clientID int
+	var guid string
+	err := tx.QueryRow("SELECT client_id, address FROM credit_lots WHERE id = $1", id).Scan(&clientID, &guid)
+	if err != nil {
+		return err
+	}
+	// wallet before lot, in the order the debits take them
+	if err = lockWallet(tx, clientID, guid); err != nil {
+		return err
+	}
+
+	var code, bucket, status string
+	var remaining, bucketBalance Amount
+	err = tx.QueryRow("SELECT l.reference_code, l.bucket, l.remaining, l.status, COALESCE(b.balance, 0) "+
+		" FROM credit_lots l LEFT JOIN wallet_buckets b ON b.client_id = l.client_id AND b.address = l.address "+
+		"   AND b.bucket = l.bucket WHERE l.id = $1 FOR UPDATE OF l", id).Scan(&code, &bucket, &remaining, &status, &bucketBalance)
+	if err != nil {
+		return err
+	}
+	if status != LotOpen {
+		// expired by a concurrent sweep
+		return nil
+	}
+
+	// never take more than the bucket still holds
+	amt := remaining
+	if amt > bucketBalance {
+		amt = bucketBalance
+	}
+	if amt > 0 {
+		expiry := Transaction{
+			ClientID:          clientID,
+			Address:           guid,
+			TransactionType:   "dr",
+			DrAmount:          amt,
+			MethodType:        MethodExpiry,
+			Particulars:       fmt.Sprintf("Expired credit %s", code),
+			ExternalReference: code,
+			Buckets:           BucketBreakdown{{Bucket: bucket, Amount: amt}},
+			lot:               id,
+			noLimits:          true,
+		}
+		if err = postTransaction(tx, &expiry); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE credit_lots SET status = $2, remaining = 0, expired_at = $3 WHERE id = $1",
+		id, LotExpired, time.Now().Local())
+
+	return err
+}
+
+// getExpiringAmounts return the open lot money of the e-Wallet by expiry day
+func getExpiringAmounts(q querier, id int, guid string) ([]ExpiringAmount, error) {
+	rows, err := q.Query("SELECT to_char(expires_at, 'YYYY-MM-DD') AS day, SUM(remaining) FROM credit_lots "+
+		" WHERE client_id = $1 AND address = $2 AND status = $3 AND remaining > 0 GROUP BY day ORDER BY day",
+		id, guid, LotOpen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var expiring []ExpiringAmount
+	for rows.Next() {
+		var e ExpiringAmount
+		if err := rows.Scan(&e.Date, &e.Amount); err != nil {
+			return nil, err
+		}
+		expiring = append(expiring, e)
+	}
+
+	return expiring, rows.Err()
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Overdraft is the credit line settings of an e-Wallet
+type Overdraft struct {
+	CreditLimit    Amount `json:"creditLimit"`
+	OverdraftFirst bool   `json:"overdraftFirst"`
+}
+
+// SetOverdraft change the credit limit and the credit rule of the e-Wallet, lowering the
+// limit below the drawn overdraft only blocks further debits
+func (db *DB) SetOverdraft(id int, guid string, o *Overdraft) (*Wallet, error) {
+	var wallet Wallet
+
+	err := db.withTx(func(tx *sql.Tx) error {
+		if o.CreditLimit < 0 {
+			return ErrInvalidAmount
+		}
+		if err := lockWallet(tx, id, guid); err != nil {
+			return err
+		}
+		if _, err := walletCurrency(tx, id, guid, new(string), o.CreditLimit); err != nil {
+			return err
+		}
+
+		return scanWallet(tx.QueryRow("UPDATE wallets SET credit_limit = $3, overdraft_first = $4, updated_at = $5 "+
+			" WHERE client_id = $1 AND address = $2 RETURNING "+walletColumns,
+			id, guid, o.CreditLimit, o.OverdraftFirst, time.Now().Local()), &wallet)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &wallet, nil
+}
+
+// RepayOverdraft use up to amt of the spendable money to repay the drawn overdraft, zero amt
+// repays as much as possible. The net balance does not change.
+func (db *DB) RepayOverdraft(id int, guid string, amt Amount) (*Wallet, error) {
+	var wallet Wallet
+
+	err := db.withTx(func(tx *sql.Tx) error {
+		if amt < 0 {
+			return ErrInvalidAmount
+		}
+		if err := lockWallet(tx, id, guid); err != nil {
+			return err
+		}
+		if _, err := walletCurrency(tx, id, guid, new(string), amt); err != nil {
+			return err
+		}
+
+		return scanWallet(tx.QueryRow("UPDATE wallets SET updated_at = $4, overdraft_used = overdraft_used - "+
+			" LEAST(CASE WHEN $3 = 0 THEN overdraft_used ELSE $3 END, overdraft_used, GREATEST(balance + overdraft_used, 0)) "+
+			" WHERE client_id = $1 AND address = $2 RETURNING "+walletColumns,
+			id, guid, amt, time.Now().Local()), &wallet)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &wallet, nil
+}
+
+// GetAllOverdraft return the e-Wallets of the client that have drawn on their credit line, largest first
+func (db *DB) GetAllOverdraft(id int) ([]Wallet, error) {
+	rows, err := db.Query("SELECT "+walletColumns+" FROM wallets WHERE client_id = $1 AND (overdraft_used > 0 OR balance < 0) "+
+		" ORDER BY overdraft_used DESC, balance", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wallets []Wallet
+	for rows.Next() {
+		var wallet Wallet
+		err := scanWallet(rows, &wallet)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		wallets = append(wallets, wallet)
+	}
+
+	return wallets, nil
+}
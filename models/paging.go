@@ -0,0 +1,154 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a page cursor can not be decoded
+var ErrInvalidCursor = errors.New("Invalid page cursor")
+
+// page sizes
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 200
+)
+
+// PageRequest asks for one page of a listing, Desc is the order of the first page,
+// a cursor keeps the order it was issued with
+type PageRequest struct {
+	Cursor string
+	Limit  int
+	Desc   bool
+}
+
+// Paging is returned with a page, Next and Prev are the cursors of the adjacent pages
+type Paging struct {
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Limit int    `json:"limit"`
+}
+
+// cursor is the keyset position a page starts after, At and ID are the sort key of a row
+type cursor struct {
+	At   time.Time
+	ID   int
+	Prev bool
+	Desc bool
+}
+
+func (c cursor) String() string {
+	s := fmt.Sprintf("%s|%d|%t|%t", c.At.Format(time.RFC3339Nano), c.ID, c.Prev, c.Desc)
+
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.Split(string(b), "|")
+	if len(parts) != 4 {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if c.At, err = time.Parse(time.RFC3339Nano, parts[0]); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.ID, err = strconv.Atoi(parts[1]); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	c.Prev = parts[2] == "true"
+	c.Desc = parts[3] == "true"
+
+	return &c, nil
+}
+
+// keyset is the SQL side of a page: the rows are read in order after the cursor key with op
+type keyset struct {
+	after *cursor
+	desc  bool
+	op    string
+	order string
+	limit int
+}
+
+// keyset decode the cursor and work out the direction the rows are read in
+func (r PageRequest) keyset() (*keyset, error) {
+	k := keyset{desc: r.Desc, limit: r.Limit}
+	if k.limit <= 0 {
+		k.limit = DefaultPageSize
+	}
+	if k.limit > MaxPageSize {
+		k.limit = MaxPageSize
+	}
+	if r.Cursor != "" {
+		c, err := decodeCursor(r.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		k.after = c
+		k.desc = c.Desc
+	}
+
+	// a previous page is read backwards from the cursor, then put back in order
+	readDesc := k.desc
+	if k.after != nil && k.after.Prev {
+		readDesc = !readDesc
+	}
+	k.op, k.order = ">", "ASC"
+	if readDesc {
+		k.op, k.order = "<", "DESC"
+	}
+
+	return &k, nil
+}
+
+// backwards tells if the rows were read in reverse and must be flipped
+func (k *keyset) backwards() bool {
+	return k.after != nil && k.after.Prev
+}
+
+// args return the cursor time and id query arguments, nil on the first page
+func (k *keyset) args() (interface{}, interface{}) {
+	if k.after == nil {
+		return nil, nil
+	}
+
+	return k.after.At, k.after.ID
+}
+
+// paging build the cursors of the page from the keys of its first and last rows,
+// n is the number of rows read which is one over the limit when more remain
+func (k *keyset) paging(n int, firstAt time.Time, firstID int, lastAt time.Time, lastID int) *Paging {
+	p := Paging{Limit: k.limit}
+	if n == 0 {
+		return &p
+	}
+	more := n > k.limit
+	next := cursor{At: lastAt, ID: lastID, Desc: k.desc}.String()
+	prev := cursor{At: firstAt, ID: firstID, Prev: true, Desc: k.desc}.String()
+
+	if k.backwards() {
+		// came back from a later page, there is always a next one
+		p.Next = next
+		if more {
+			p.Prev = prev
+		}
+		return &p
+	}
+	if more {
+		p.Next = next
+	}
+	if k.after != nil {
+		p.Prev = prev
+	}
+
+	return &p
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	at := time.Date(2026, 10, 18, 10, 7, 30, 123456789, time.UTC)
+	tests := []cursor{
+		{At: at, ID: 42},
+		{At: at, ID: 1, Prev: true},
+		{At: at, ID: 7, Desc: true},
+		{At: at.In(time.FixedZone("PHT", 8*3600)), ID: 99, Prev: true, Desc: true},
+	}
+
+	for _, c := range tests {
+		got, err := decodeCursor(c.String())
+		if err != nil {
+			t.Errorf("decodeCursor(%v) error = %v", c, err)
+			continue
+		}
+		if !got.At.Equal(c.At) || got.ID != c.ID || got.Prev != c.Prev || got.Desc != c.Desc {
+			t.Errorf("decodeCursor(%v) = %v", c, *got)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	encode := func(s string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(s))
+	}
+	tests := []string{
+		"",
+		"not base64!",
+		encode("2026-10-18T10:07:30Z|42|false"),
+		encode("2026-10-18T10:07:30Z|42|false|false|x"),
+		encode("yesterday|42|false|false"),
+		encode("2026-10-18T10:07:30Z|x|false|false"),
+	}
+
+	for _, s := range tests {
+		if _, err := decodeCursor(s); err != ErrInvalidCursor {
+			t.Errorf("decodeCursor(%q) error = %v, want ErrInvalidCursor", s, err)
+		}
+	}
+}
+
+func TestPageRequestKeyset(t *testing.T) {
+	at := time.Date(2026, 10, 18, 10, 7, 30, 0, time.UTC)
+	tests := []struct {
+		name  string
+		r     PageRequest
+		limit int
+		desc  bool
+		op    string
+		order string
+	}{
+		{"defaults", PageRequest{}, DefaultPageSize, false, ">", "ASC"},
+		{"descending first page", PageRequest{Desc: true, Limit: 10}, 10, true, "<", "DESC"},
+		{"limit is capped", PageRequest{Limit: MaxPageSize + 1}, MaxPageSize, false, ">", "ASC"},
+		{"negative limit", PageRequest{Limit: -1}, DefaultPageSize, false, ">", "ASC"},
+		{"next page keeps the cursor order", PageRequest{Cursor: cursor{At: at, ID: 1, Desc: true}.String()},
+			DefaultPageSize, true, "<", "DESC"},
+		{"previous page reads backwards", PageRequest{Cursor: cursor{At: at, ID: 1, Prev: true}.String()},
+			DefaultPageSize, false, "<", "DESC"},
+		{"previous descending page reads forwards", PageRequest{Cursor: cursor{At: at, ID: 1, Prev: true, Desc: true}.String()},
+			DefaultPageSize, true, ">", "ASC"},
+	}
+
+	for _, tt := range tests {
+		k, err := tt.r.keyset()
+		if err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+			continue
+		}
+		if k.limit != tt.limit || k.desc != tt.desc || k.op != tt.op || k.order != tt.order {
+			t.Errorf("%s: keyset = %d, %t, %s, %s, want %d, %t, %s, %s", tt.name,
+				k.limit, k.desc, k.op, k.order, tt.limit, tt.desc, tt.op, tt.order)
+		}
+	}
+
+	if _, err := (PageRequest{Cursor: "bad"}).keyset(); err != ErrInvalidCursor {
+		t.Errorf("bad cursor: error = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestKeysetPaging(t *testing.T) {
+	first := time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)
+	last := first.Add(time.Hour)
+	after := &cursor{At: first.Add(-time.Hour), ID: 1}
+	before := &cursor{At: last.Add(time.Hour), ID: 9, Prev: true}
+
+	tests := []struct {
+		name       string
+		k          keyset
+		n          int
+		next, prev bool
+	}{
+		{"empty page", keyset{limit: 2}, 0, false, false},
+		{"only page", keyset{limit: 2}, 2, false, false},
+		{"first of more pages", keyset{limit: 2}, 3, true, false},
+		{"middle page", keyset{limit: 2, after: after}, 3, true, true},
+		{"last page", keyset{limit: 2, after: after}, 2, false, true},
+		{"back to a middle page", keyset{limit: 2, after: before}, 3, true, true},
+		{"back to the first page", keyset{limit: 2, after: before}, 2, true, false},
+	}
+
+	for _, tt := range tests {
+		p := tt.k.paging(tt.n, first, 2, last, 3)
+		if (p.Next != "") != tt.next || (p.Prev != "") != tt.prev || p.Limit != tt.k.limit {
+			t.Errorf("%s: paging = %+v, want next %t, prev %t", tt.name, *p, tt.next, tt.prev)
+			continue
+		}
+		if p.Next != "" {
+			c, err := decodeCursor(p.Next)
+			if err != nil || !c.At.Equal(last) || c.ID != 3 || c.Prev {
+				t.Errorf("%s: next cursor = %v, %v", tt.name, c, err)
+			}
+		}
+		if p.Prev != "" {
+			c, err := decodeCursor(p.Prev)
+			if err != nil || !c.At.Equal(first) || c.ID != 2 || !c.Prev {
+				t.Errorf("%s: prev cursor = %v, %v", tt.name, c, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// RateScale is the number of decimal places kept by a Rate
+const RateScale = 8
+
+// rateUnit is the number of Rate units in 1.0
+const rateUnit = 100000000
+
+// Rate is an exact decimal factor such as an exchange rate or a percentage,
+// counted in 1/10^RateScale units and stored in NUMERIC(24,8) columns
+type Rate int64
+
+// ErrInvalidRate is returned when a value can not be read as a Rate
+var ErrInvalidRate = errors.New("Invalid rate")
+
+// ParseRate read a decimal string like "56.125" or "0.005", extra decimals are rounded half even
+func ParseRate(s string) (Rate, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return 0, ErrInvalidRate
+	}
+	v, err := fixedFromRat(r, rateUnit, RoundHalfEven)
+	if err != nil {
+		return 0, ErrInvalidRate
+	}
+
+	return Rate(v), nil
+}
+
+// rat return the rate as an exact fraction
+func (r Rate) rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(int64(r)), big.NewInt(rateUnit))
+}
+
+// Mul return r times o rounded half even to the Rate scale
+func (r Rate) Mul(o Rate) Rate {
+	v, _ := fixedFromRat(new(big.Rat).Mul(r.rat(), o.rat()), rateUnit, RoundHalfEven)
+
+	return Rate(v)
+}
+
+// Inverse return 1/r rounded half even to the Rate scale, zero for a zero rate
+func (r Rate) Inverse() Rate {
+	if r == 0 {
+		return 0
+	}
+	v, _ := fixedFromRat(new(big.Rat).Inv(r.rat()), rateUnit, RoundHalfEven)
+
+	return Rate(v)
+}
+
+// String return the rate with all RateScale decimals
+func (r Rate) String() string {
+	return formatFixed(int64(r), rateUnit, RateScale)
+}
+
+// MarshalJSON emit the rate as an exact JSON number
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalJSON accept the rate as a JSON number or a string
+func (r *Rate) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if uq, err := strconv.Unquote(s); err == nil {
+		s = uq
+	}
+	v, err := ParseRate(s)
+	if err != nil {
+		return fmt.Errorf("Invalid rate %s", b)
+	}
+	*r = v
+
+	return nil
+}
+
+// Scan read a NUMERIC column
+func (r *Rate) Scan(src interface{}) error {
+	var err error
+	switch v := src.(type) {
+	case nil:
+		*r = 0
+	case []byte:
+		*r, err = ParseRate(string(v))
+	case string:
+		*r, err = ParseRate(v)
+	case int64:
+		if v > math.MaxInt64/rateUnit || v < math.MinInt64/rateUnit {
+			return ErrInvalidRate
+		}
+		*r = Rate(v * rateUnit)
+	case float64:
+		*r, err = ParseRate(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		err = fmt.Errorf("Cannot scan %T into Rate", src)
+	}
+
+	return err
+}
+
+// Value write the rate as an exact decimal string for NUMERIC columns
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Rate
+		err  bool
+	}{
+		{in: "56.125", want: 5612500000},
+		{in: "0.005", want: 500000},
+		{in: "-1", want: -100000000},
+		{in: "0.00000001", want: 1},
+		// extra decimals are rounded half even
+		{in: "0.000000005", want: 0},
+		{in: "0.000000015", want: 2},
+		{in: "", err: true},
+		{in: "1/0", err: true},
+		{in: "rate", err: true},
+		{in: "1e12", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if tt.err {
+			if err != ErrInvalidRate {
+				t.Errorf("ParseRate(%q) error = %v, want ErrInvalidRate", tt.in, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestRateMulInverse(t *testing.T) {
+	tests := []struct {
+		a, b    string
+		mul     string
+		inverse string
+	}{
+		{"1.5", "2", "3.00000000", "0.66666667"},
+		{"4", "0.25", "1.00000000", "0.25000000"},
+		{"3", "1", "3.00000000", "0.33333333"},
+		{"0.00000001", "0.5", "0.00000000", "100000000.00000000"},
+		{"0", "56.125", "0.00000000", "0.00000000"},
+	}
+
+	for _, tt := range tests {
+		a, b := mustParseRate(t, tt.a), mustParseRate(t, tt.b)
+		if got := a.Mul(b).String(); got != tt.mul {
+			t.Errorf("%s.Mul(%s) = %s, want %s", tt.a, tt.b, got, tt.mul)
+		}
+		if got := a.Inverse().String(); got != tt.inverse {
+			t.Errorf("%s.Inverse() = %s, want %s", tt.a, got, tt.inverse)
+		}
+	}
+}
+
+func TestRateScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Rate
+		err  bool
+	}{
+		{src: nil, want: 0},
+		{src: []byte("56.12500000"), want: 5612500000},
+		{src: "0.005", want: 500000},
+		{src: int64(2), want: 200000000},
+		{src: int64(math.MaxInt64/rateUnit + 1), err: true},
+		{src: int64(math.MinInt64/rateUnit - 1), err: true},
+		{src: 1.25, want: 125000000},
+		{src: true, err: true},
+	}
+
+	for _, tt := range tests {
+		var got Rate
+		err := got.Scan(tt.src)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Scan(%v) = %d, want an error", tt.src, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Scan(%v) = %d, %v, want %d", tt.src, got, err, tt.want)
+		}
+	}
+}
+
+func TestRateJSON(t *testing.T) {
+	r := mustParseRate(t, "56.125")
+	b, err := r.MarshalJSON()
+	if err != nil || string(b) != "56.12500000" {
+		t.Fatalf("MarshalJSON = %s, %v", b, err)
+	}
+
+	var got Rate
+	if err = got.UnmarshalJSON(b); err != nil || got != r {
+		t.Errorf("UnmarshalJSON(%s) = %d, %v, want %d", b, got, err, r)
+	}
+	if err = got.UnmarshalJSON([]byte(`"0.5"`)); err != nil || got != 50000000 {
+		t.Errorf("UnmarshalJSON(\"0.5\") = %d, %v", got, err)
+	}
+	if err = got.UnmarshalJSON([]byte(`"x"`)); err == nil {
+		t.Error("UnmarshalJSON(\"x\") want an error")
+	}
+}
+
+func mustParseRate(t *testing.T, s string) Rate {
+	r, err := ParseRate(s)
+	if err != nil {
+		t.Fatalf("ParseRate(%q): %v", s, err)
+	}
+
+	return r
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrBreakNotFound is returned when resolving an unknown or already resolved break
+var ErrBreakNotFound = errors.New("Reconciliation break not found or already resolved")
+
+// break statuses
+const (
+	BreakOpen     = "open"
+	BreakResolved = "resolved"
+)
+
+// ReconRun is one pass of the reconciliation over every e-Wallet
+type ReconRun struct {
+	ID             int       `json:"id"`
+	WalletsChecked int       `json:"walletsChecked"`
+	BreaksFound    int       `json:"breaksFound"`
+	BreaksCleared  int       `json:"breaksCleared"`
+	StartedAt      time.Time `json:"startedAt"`
+	FinishedAt     time.Time `json:"finishedAt"`
+}
+
+// ReconBreak is an e-Wallet whose stored balance differs from the sum of its transactions
+type ReconBreak struct {
+	ID              int    `json:"id"`
+	RunID           int    `json:"runId"`
+	ClientID        int    `json:"clientId"`
+	Address         string `json:"address"`
+	Currency        string `json:"currency"`
+	StoredBalance   Amount `json:"storedBalance"`
+	ExpectedBalance Amount `json:"expectedBalance"`
+	// Difference is StoredBalance less ExpectedBalance
+	Difference Amount     `json:"difference"`
+	Status     string     `json:"status"`
+	Note       string     `json:"note"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ResolvedAt *time.Time `json:"resolvedAt,omitempty"`
+}
+
+// reconBreakColumns is the select list read by scanReconBreak
+const reconBreakColumns = "id, run_id, client_id, address, currency, stored_balance, expected_balance, difference, " +
+	" status, note, created_at, resolved_at"
+
+func scanReconBreak(r rowScanner, b *ReconBreak) error {
+	return r.Scan(&b.ID, &b.RunID, &b.ClientID, &b.Address, &b.Currency, &b.StoredBalance, &b.ExpectedBalance,
+		&b.Difference, &b.Status, &b.Note, &b.CreatedAt, &b.ResolvedAt)
+}
+
+// Reconcile compare every e-Wallet balance with its cr/dr totals. A wallet keeps a single open
+// break that each run refreshes, breaks of wallets that balance again are resolved.
+func (db *DB) Reconcile() (*ReconRun, error) {
+	run := ReconRun{StartedAt: time.Now().Local()}
+
+	err := db.withTx(func(tx *sql.Tx) error {
+		err := tx.QueryRow("INSERT INTO recon_runs (started_at) VALUES ($1) RETURNING id;", run.StartedAt).Scan(&run.ID)
+		if err != nil {
+			return err
+		}
+		err = tx.QueryRow("SELECT count(*) FROM wallets").Scan(&run.WalletsChecked)
+		if err != nil {
+			return err
+		}
+
+		// balances and totals are read by one statement so they come from the same snapshot
+		r, err := tx.Exec("INSERT INTO recon_breaks (run_id, client_id, address, currency, stored_balance, "+
+			" expected_balance, difference, status, note, created_at) "+
+			" SELECT $1, w.client_id, w.address, w.currency, w.balance, e.expected, w.balance - e.expected, $2, '', $3 "+
+			" FROM wallets w JOIN LATERAL (SELECT COALESCE(SUM(t.cr_amount - t.dr_amount), 0) AS expected "+
+			"   FROM transactions t WHERE t.client_id = w.client_id AND t.address = w.address) e ON TRUE "+
+			" WHERE w.balance <> e.expected "+
+			// a break resolved by hand stays resolved until one of the balances moves
+			" AND NOT EXISTS (SELECT 1 FROM recon_breaks b WHERE b.client_id = w.client_id AND b.address = w.address "+
+			"   AND b.status = $4 AND b.stored_balance = w.balance AND b.expected_balance = e.expected) "+
+			" ON CONFLICT (client_id, address) WHERE status = 'open' DO UPDATE SET run_id = EXCLUDED.run_id, "+
+			" stored_balance = EXCLUDED.stored_balance, expected_balance = EXCLUDED.expected_balance, "+
+			" difference = EXCLUDED.difference",
+			run.ID, BreakOpen, run.StartedAt, BreakResolved)
+		if err != nil {
+			return err
+		}
+		found, _ := r.RowsAffected()
+		run.BreaksFound = int(found)
+
+		r, err = tx.Exec("UPDATE recon_breaks SET status = $2, note = $5, resolved_at = $3 "+
+			" WHERE status = $4 AND run_id <> $1", run.ID, BreakResolved, time.Now().Local(), BreakOpen,
+			fmt.Sprintf("balanced on run %d", run.ID))
+		if err != nil {
+			return err
+		}
+		cleared, _ := r.RowsAffected()
+		run.BreaksCleared = int(cleared)
+
+		run.FinishedAt = time.Now().Local()
+		_, err = tx.Exec("UPDATE recon_runs SET wallets_checked = $2, breaks_found = $3, breaks_cleared = $4, "+
+			" finished_at = $5 WHERE id = $1", run.ID, run.WalletsChecked, run.BreaksFound, run.BreaksCleared, run.FinishedAt)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &run, nil
+}
+
+// GetAllReconBreak return the unresolved breaks of the client, largest difference first
+func (db *DB) GetAllReconBreak(id int) ([]ReconBreak, error) {
+	rows, err := db.Query("SELECT "+reconBreakColumns+" FROM recon_breaks WHERE client_id = $1 AND status = $2 "+
+		" ORDER BY ABS(difference) DESC, id", id, BreakOpen)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var breaks []ReconBreak
+	for rows.Next() {
+		var b ReconBreak
+		err := scanReconBreak(rows, &b)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		breaks = append(breaks, b)
+	}
+
+	return breaks, nil
+}
+
+// ResolveReconBreak mark the open break as resolved after investigation
+func (db *DB) ResolveReconBreak(id, breakID int, note string) (*ReconBreak, error) {
+	var b ReconBreak
+	err := scanReconBreak(db.QueryRow("UPDATE recon_breaks SET status = $3, note = $4, resolved_at = $5 "+
+		" WHERE client_id = $1 AND id = $2 AND status = $6 RETURNING "+reconBreakColumns,
+		id, breakID, BreakResolved, note, time.Now().Local(), BreakOpen), &b)
+	if err == sql.ErrNoRows {
+		return nil, ErrBreakNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
@@ -0,0 +1,131 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var (
+	// ErrTransactionNotFound is returned when no transaction has the reference code
+	ErrTransactionNotFound = errors.New("Transaction not found")
+	// ErrReversalOfReversal is returned when the reference code is itself a reversal
+	ErrReversalOfReversal = errors.New("A reversal can not be reversed")
+	// ErrReversalExceedsOriginal is returned when the refunded total would go over the original amount
+	ErrReversalExceedsOriginal = errors.New("Reversal amount exceeds the unreversed amount of the original")
+	// ErrReversalOfTransfer is returned for a leg of a transfer or currency exchange, reversing
+	// one leg would leave the other wallet holding the funds
+	ErrReversalOfTransfer = errors.New("A transfer or exchange leg can not be reversed on its own")
+)
+
+// Reversal is a request to undo all or part of a posted transaction
+type Reversal struct {
+	ClientID      int    `json:"-"`
+	Address       string `json:"-"`
+	ReferenceCode string `json:"referenceCode"`
+	// Amount is optional, zero reverses whatever is left of the original
+	Amount      Amount `json:"amount"`
+	Particulars string `json:"particulars"`
+}
+
+// PostReversal post the opposite entry of the original transaction, linked to it by reference code,
+// the original is locked so concurrent reversals can not refund more than its amount
+func (db *DB) PostReversal(r *Reversal) (*Transaction, error) {
+	var reversal *Transaction
+
+	err := db.withTx(func(tx *sql.Tx) error {
+		orig, err := lockTransaction(tx, "reference_code", r.ClientID, r.Address, r.ReferenceCode)
+		if err != nil {
+			return err
+		}
+		if err = lockWallet(tx, r.ClientID, r.Address); err != nil {
+			return err
+		}
+		reversal = &Transaction{Particulars: r.Particulars}
+		return reverseTransaction(tx, orig, r.Amount, reversal)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reversal, nil
+}
+
+// lockTransaction read and lock the transaction of the e-Wallet whose column equals value
+func lockTransaction(tx *sql.Tx, column string, id int, guid, value string) (*Transaction, error) {
+	var t Transaction
+	err := scanTransaction(tx.QueryRow("SELECT "+transactionColumns+" FROM transactions "+
+		" WHERE client_id = $1 AND address = $2 AND "+column+" = $3 FOR UPDATE", id, guid, value), &t)
+	if err == sql.ErrNoRows {
+		return nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// reverseTransaction post reversal as the opposite entry of the locked orig for amt,
+// zero amt reverses whatever is left. The Wallet row must be locked by the caller.
+func reverseTransaction(tx *sql.Tx, orig *Transaction, amt Amount, reversal *Transaction) error {
+	if orig.ReversalOf != "" {
+		return ErrReversalOfReversal
+	}
+	if orig.TransferReference != "" {
+		return ErrReversalOfTransfer
+	}
+
+	remaining := orig.Amount() - orig.ReversedAmount
+	if amt == 0 {
+		amt = remaining
+	}
+	if amt <= 0 || amt > remaining {
+		return ErrReversalExceedsOriginal
+	}
+
+	reversal.ClientID = orig.ClientID
+	reversal.Address = orig.Address
+	reversal.Currency = orig.Currency
+	reversal.ReversalOf = orig.ReferenceCode
+	// a refund or a taken back credit undoes a posting that already passed the limits
+	reversal.noLimits = true
+	if orig.FeeOf != "" {
+		// a refunded fee comes back out of the fee account
+		reversal.contra = AccountFees
+	}
+	if reversal.MethodType == "" {
+		reversal.MethodType = orig.MethodType
+	}
+	if reversal.Particulars == "" {
+		reversal.Particulars = "Reversal of " + orig.ReferenceCode
+	}
+	if orig.TransactionType == "cr" {
+		// taking back a credit must fit in the available balance and the credit line
+		if !isBalanceEnoughForDebit(tx, orig.ClientID, orig.Address, amt) {
+			return ErrInsufficientBalance
+		}
+		reversal.TransactionType = "dr"
+		reversal.DrAmount = amt
+		// take it back from the bucket it went to first
+		if len(orig.Buckets) > 0 {
+			reversal.Bucket = orig.Buckets[0].Bucket
+		}
+	} else {
+		reversal.TransactionType = "cr"
+		reversal.CrAmount = amt
+		buckets, err := reversalBuckets(tx, orig, amt)
+		if err != nil {
+			return err
+		}
+		reversal.Buckets = buckets
+	}
+	if err := postTransaction(tx, reversal); err != nil {
+		return err
+	}
+
+	orig.ReversedAmount += amt
+	orig.setReversalStatus()
+	_, err := tx.Exec("UPDATE transactions SET reversed_amount = $2 WHERE id = $1", orig.ID, orig.ReversedAmount)
+
+	return err
+}
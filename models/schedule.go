@@ -0,0 +1,405 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+var (
+	// ErrInvalidSchedule is returned for a schedule without an amount, a cr/dr direction, a method type,
+	// or with not exactly one of cron and interval
+	ErrInvalidSchedule = errors.New("Schedule needs an amount, a cr/dr transaction type, a method type and either a cron or an interval")
+	// ErrScheduleNotFound is returned for an unknown schedule
+	ErrScheduleNotFound = errors.New("Schedule not found")
+	// ErrScheduleStatus is returned when pausing, resuming or cancelling a schedule in the wrong status
+	ErrScheduleStatus = errors.New("Schedule can not change to this status")
+)
+
+// schedule statuses
+const (
+	ScheduleActive    = "active"
+	SchedulePaused    = "paused"
+	ScheduleCancelled = "cancelled"
+	// ScheduleEnded is a schedule whose next run would be past EndsAt
+	ScheduleEnded = "ended"
+)
+
+// schedule run statuses
+const (
+	RunPosted = "posted"
+	RunFailed = "failed"
+)
+
+// default retries of a run that failed, e.g. on insufficient balance
+const (
+	DefaultScheduleRetries    = 3
+	DefaultScheduleRetryEvery = time.Hour
+)
+
+// Schedule posts the same cr/dr to an e-Wallet on a cron expression or a fixed interval.
+// A failed run is retried MaxRetries times RetryEvery apart before moving to the next occurrence.
+type Schedule struct {
+	ID              int    `json:"id"`
+	ClientID        int    `json:"-"`
+	Address         string `json:"address"`
+	TransactionType string `json:"transactionType"`
+	Amount          Amount `json:"amount"`
+	MethodType      string `json:"methodType"`
+	Particulars     string `json:"particulars"`
+	// Cron is a five field expression, Interval a duration like "24h", only one is set
+	Cron     string `json:"cron,omitempty"`
+	Interval string `json:"interval,omitempty"`
+	// StartAt is the first run, by default the first occurrence from now
+	StartAt    *time.Time `json:"startAt,omitempty"`
+	EndsAt     *time.Time `json:"endsAt,omitempty"`
+	MaxRetries *int       `json:"maxRetries,omitempty"`
+	RetryEvery string     `json:"retryEvery,omitempty"`
+	Status     string     `json:"status"`
+	// NextRunAt is the occurrence due next, RetryAt is set while a failed run waits for its retry
+	NextRunAt *time.Time `json:"nextRunAt,omitempty"`
+	RetryAt   *time.Time `json:"retryAt,omitempty"`
+	Attempts  int        `json:"attempts"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// ScheduleRun is one attempt of a schedule at posting an occurrence
+type ScheduleRun struct {
+	ID            int       `json:"id"`
+	ScheduleID    int       `json:"scheduleId"`
+	DueAt         time.Time `json:"dueAt"`
+	Attempt       int       `json:"attempt"`
+	Status        string    `json:"status"`
+	ReferenceCode string    `json:"referenceCode,omitempty"`
+	Error         string    `json:"error,omitempty"`
+	RunAt         time.Time `json:"runAt"`
+}
+
+// scheduleColumns is the select list read by scanSchedule
+const scheduleColumns = "id, client_id, address, transaction_type, amount, method_type, particulars, cron, every, " +
+	" start_at, ends_at, max_retries, retry_every, status, next_run_at, retry_at, attempts, created_at, updated_at"
+
+func scanSchedule(r rowScanner, s *Schedule) error {
+	return r.Scan(&s.ID, &s.ClientID, &s.Address, &s.TransactionType, &s.Amount, &s.MethodType, &s.Particulars,
+		&s.Cron, &s.Interval, &s.StartAt, &s.EndsAt, &s.MaxRetries, &s.RetryEvery, &s.Status, &s.NextRunAt,
+		&s.RetryAt, &s.Attempts, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// CreateSchedule validate the recurrence and save the schedule of the active e-Wallet with its first run
+func (db *DB) CreateSchedule(s *Schedule) error {
+	if s.Amount <= 0 || (s.TransactionType != "cr" && s.TransactionType != "dr") || s.MethodType == "" ||
+		(s.Cron == "") == (s.Interval == "") {
+		return ErrInvalidSchedule
+	}
+	if s.MaxRetries == nil {
+		retries := DefaultScheduleRetries
+		s.MaxRetries = &retries
+	}
+	if *s.MaxRetries < 0 {
+		return ErrInvalidSchedule
+	}
+	if s.RetryEvery == "" {
+		s.RetryEvery = DefaultScheduleRetryEvery.String()
+	}
+	if d, err := time.ParseDuration(s.RetryEvery); err != nil || d <= 0 {
+		return ErrInvalidSchedule
+	}
+
+	now := time.Now().Local()
+	first := s.StartAt
+	if first == nil {
+		next, err := s.nextAfter(now)
+		if err != nil {
+			return err
+		}
+		first = &next
+	} else if _, err := s.nextAfter(now); err != nil {
+		// still validate the recurrence
+		return err
+	}
+	s.Status = ScheduleActive
+	s.NextRunAt = first
+	if first.IsZero() || (s.EndsAt != nil && first.After(*s.EndsAt)) {
+		return ErrInvalidSchedule
+	}
+
+	return db.withTx(func(tx *sql.Tx) error {
+		// the e-Wallet must be of the client and active, and stay so until the schedule is saved
+		if err := lockWallet(tx, s.ClientID, s.Address); err != nil {
+			return err
+		}
+
+		return scanSchedule(tx.QueryRow("INSERT INTO schedules (client_id, address, transaction_type, amount, method_type, "+
+			" particulars, cron, every, start_at, ends_at, max_retries, retry_every, status, next_run_at, attempts, "+
+			" created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, 0, $15, $15) "+
+			" RETURNING "+scheduleColumns,
+			s.ClientID, s.Address, s.TransactionType, s.Amount, s.MethodType, s.Particulars, s.Cron, s.Interval,
+			s.StartAt, s.EndsAt, *s.MaxRetries, s.RetryEvery, s.Status, s.NextRunAt, now), s)
+	})
+}
+
+// GetAllSchedule return the schedules of the e-Wallet
+func (db *DB) GetAllSchedule(id int, guid string) ([]Schedule, error) {
+	rows, err := db.Query("SELECT "+scheduleColumns+" FROM schedules WHERE client_id = $1 AND address = $2 "+
+		" ORDER BY id", id, guid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []Schedule
+	for rows.Next() {
+		var s Schedule
+		err := scanSchedule(rows, &s)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		schedules = append(schedules, s)
+	}
+
+	return schedules, nil
+}
+
+// GetAllScheduleRun return the run history of the schedule, latest first
+func (db *DB) GetAllScheduleRun(id int, guid string, scheduleID int) ([]ScheduleRun, error) {
+	rows, err := db.Query("SELECT r.id, r.schedule_id, r.due_at, r.attempt, r.status, r.reference_code, r.error, r.run_at "+
+		" FROM schedule_runs r JOIN schedules s ON s.id = r.schedule_id "+
+		" WHERE s.client_id = $1 AND s.address = $2 AND s.id = $3 ORDER BY r.id DESC", id, guid, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []ScheduleRun
+	for rows.Next() {
+		var r ScheduleRun
+		err := rows.Scan(&r.ID, &r.ScheduleID, &r.DueAt, &r.Attempt, &r.Status, &r.ReferenceCode, &r.Error, &r.RunAt)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		runs = append(runs, r)
+	}
+
+	return runs, nil
+}
+
+// PauseSchedule stop an active schedule from running until it is resumed
+func (db *DB) PauseSchedule(id int, guid string, scheduleID int) (*Schedule, error) {
+	return db.setScheduleStatus(id, guid, scheduleID, SchedulePaused, ScheduleActive)
+}
+
+// ResumeSchedule restart a paused schedule, the occurrences missed while paused are skipped
+func (db *DB) ResumeSchedule(id int, guid string, scheduleID int) (*Schedule, error) {
+	return db.setScheduleStatus(id, guid, scheduleID, ScheduleActive, SchedulePaused)
+}
+
+// CancelSchedule stop the schedule for good
+func (db *DB) CancelSchedule(id int, guid string, scheduleID int) (*Schedule, error) {
+	return db.setScheduleStatus(id, guid, scheduleID, ScheduleCancelled, ScheduleActive, SchedulePaused)
+}
+
+func (db *DB) setScheduleStatus(id int, guid string, scheduleID int, status string, from ...string) (*Schedule, error) {
+	var s Schedule
+	err := db.withTx(func(tx *sql.Tx) error {
+		err := scanSchedule(tx.QueryRow("SELECT "+scheduleColumns+" FROM schedules "+
+			" WHERE client_id = $1 AND address = $2 AND id = $3 FOR UPDATE", id, guid, scheduleID), &s)
+		if err == sql.ErrNoRows {
+			return ErrScheduleNotFound
+		}
+		if err != nil {
+			return err
+		}
+		allowed := false
+		for _, f := range from {
+			allowed = allowed || s.Status == f
+		}
+		if !allowed {
+			return ErrScheduleStatus
+		}
+
+		now := time.Now().Local()
+		s.Status = status
+		if status == ScheduleActive && s.NextRunAt.Before(now) {
+			next, err := s.nextAfter(now)
+			if err != nil {
+				return err
+			}
+			s.NextRunAt, s.RetryAt, s.Attempts = &next, nil, 0
+		}
+
+		return s.save(tx, now)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// RunDueSchedules post every schedule occurrence that is due, returns how many runs were posted.
+// The run, its posting and the move to the next occurrence commit together, and the posting uses
+// the idempotency key "schedule:<id>:<due>", so a restart in the middle never posts a run twice.
+func (db *DB) RunDueSchedules() (int, error) {
+	rows, err := db.Query("SELECT id FROM schedules WHERE status = $1 AND COALESCE(retry_at, next_run_at) <= $2 "+
+		" ORDER BY COALESCE(retry_at, next_run_at), id", ScheduleActive, time.Now().Local())
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+
+	posted := 0
+	for _, id := range ids {
+		var ok bool
+		err := db.withTx(func(tx *sql.Tx) error {
+			var err error
+			ok, err = runSchedule(tx, id)
+			return err
+		})
+		if err != nil {
+			log.Println("Run schedule ", id, ": ", err)
+			continue
+		}
+		if ok {
+			posted++
+		}
+	}
+
+	return posted, nil
+}
+
+// runSchedule post the due occurrence of the schedule, tells if it was posted. A schedule locked
+// by another scheduler or no longer due is skipped.
+func runSchedule(tx *sql.Tx, id int) (bool, error) {
+	var s Schedule
+	now := time.Now().Local()
+	err := scanSchedule(tx.QueryRow("SELECT "+scheduleColumns+" FROM schedules "+
+		" WHERE id = $1 AND status = $2 AND COALESCE(retry_at, next_run_at) <= $3 FOR UPDATE SKIP LOCKED",
+		id, ScheduleActive, now), &s)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	due := *s.NextRunAt
+	t := Transaction{
+		ClientID:    s.ClientID,
+		Address:     s.Address,
+		MethodType:  s.MethodType,
+		Particulars: s.Particulars,
+	}
+	if t.Particulars == "" {
+		t.Particulars = fmt.Sprintf("Scheduled %s %d", s.MethodType, s.ID)
+	}
+	key := fmt.Sprintf("%s%d:%d", scheduleKeyPrefix, s.ID, due.Unix())
+
+	// a failed posting is undone on its own, the run is still recorded
+	if _, err = tx.Exec("SAVEPOINT schedule_run"); err != nil {
+		return false, err
+	}
+	var posted *Transaction
+	if s.TransactionType == "cr" {
+		t.CrAmount = s.Amount
+		posted, err = postCredit(tx, &t, key)
+	} else {
+		t.DrAmount = s.Amount
+		posted, err = postDebit(tx, &t, key)
+	}
+
+	s.Attempts++
+	run := ScheduleRun{ScheduleID: s.ID, DueAt: due, Attempt: s.Attempts, Status: RunPosted, RunAt: now}
+	if err != nil {
+		if _, rerr := tx.Exec("ROLLBACK TO SAVEPOINT schedule_run"); rerr != nil {
+			return false, rerr
+		}
+		run.Status = RunFailed
+		run.Error = err.Error()
+	} else {
+		run.ReferenceCode = posted.ReferenceCode
+	}
+	_, err = tx.Exec("INSERT INTO schedule_runs (schedule_id, due_at, attempt, status, reference_code, error, run_at) "+
+		" VALUES ($1, $2, $3, $4, $5, $6, $7)",
+		run.ScheduleID, run.DueAt, run.Attempt, run.Status, run.ReferenceCode, run.Error, run.RunAt)
+	if err != nil {
+		return false, err
+	}
+
+	if run.Status == RunFailed && s.Attempts <= *s.MaxRetries {
+		every, err := time.ParseDuration(s.RetryEvery)
+		if err != nil {
+			return false, err
+		}
+		retry := now.Add(every)
+		s.RetryAt = &retry
+		return false, s.save(tx, now)
+	}
+
+	// posted, or out of retries: go to the next occurrence, skipping the ones missed while down
+	after := due
+	if now.After(after) {
+		after = now
+	}
+	next, err := s.nextAfter(after)
+	if err != nil {
+		return false, err
+	}
+	s.NextRunAt, s.RetryAt, s.Attempts = &next, nil, 0
+	if next.IsZero() || (s.EndsAt != nil && next.After(*s.EndsAt)) {
+		s.Status = ScheduleEnded
+		s.NextRunAt = nil
+	}
+
+	return run.Status == RunPosted, s.save(tx, now)
+}
+
+// nextAfter return the first occurrence of the recurrence after t
+func (s *Schedule) nextAfter(t time.Time) (time.Time, error) {
+	if s.Cron != "" {
+		c, err := parseCron(s.Cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return c.next(t), nil
+	}
+
+	d, err := time.ParseDuration(s.Interval)
+	if err != nil || d < time.Minute {
+		return time.Time{}, ErrInvalidSchedule
+	}
+	if s.NextRunAt == nil || s.NextRunAt.After(t) {
+		return t.Add(d), nil
+	}
+	// keep the interval aligned on the previous occurrences
+	next := *s.NextRunAt
+	for !next.After(t) {
+		next = next.Add(d)
+	}
+
+	return next, nil
+}
+
+func (s *Schedule) save(tx *sql.Tx, now time.Time) error {
+	s.UpdatedAt = now
+	_, err := tx.Exec("UPDATE schedules SET status = $2, next_run_at = $3, retry_at = $4, attempts = $5, updated_at = $6 "+
+		" WHERE id = $1", s.ID, s.Status, s.NextRunAt, s.RetryAt, s.Attempts, s.UpdatedAt)
+
+	return err
+}
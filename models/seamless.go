@@ -0,0 +1,270 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	// ErrRoundClosed is returned when a bet or win arrives after endRound
+	ErrRoundClosed = errors.New("Game round already ended")
+	// ErrBetRolledBack is returned when a bet arrives after its rollback was recorded as a tombstone
+	ErrBetRolledBack = errors.New("Bet was already rolled back")
+	// ErrRoundNotFound is returned when ending or reading an unknown round
+	ErrRoundNotFound = errors.New("Game round not found")
+	// ErrRoundOtherWallet is returned when a bet or win names a round opened by another e-Wallet
+	ErrRoundOtherWallet = errors.New("Game round belongs to another e-Wallet")
+)
+
+// seamless operations, stored as the transaction method type
+const (
+	SeamlessBet      = "bet"
+	SeamlessWin      = "win"
+	SeamlessRollback = "rollback"
+)
+
+// round statuses
+const (
+	RoundOpen   = "open"
+	RoundClosed = "closed"
+)
+
+// SeamlessRequest is a bet, win or rollback sent by a game provider
+type SeamlessRequest struct {
+	ClientID     int    `json:"-"`
+	Address      string `json:"address"`
+	ProviderTxID string `json:"providerTxId"`
+	RoundID      string `json:"roundId"`
+	Currency     string `json:"currency"`
+	Amount       Amount `json:"amount"`
+	// ReferenceTxID is the provider transaction id of the bet to rollback
+	ReferenceTxID string `json:"referenceTxId,omitempty"`
+	Particulars   string `json:"particulars"`
+}
+
+// SeamlessResult is the answer to a seamless operation, Balance is the Wallet balance after it
+type SeamlessResult struct {
+	ProviderTxID string       `json:"providerTxId"`
+	RoundID      string       `json:"roundId"`
+	Currency     string       `json:"currency"`
+	Balance      Amount       `json:"balance"`
+	Transaction  *Transaction `json:"transaction,omitempty"`
+	// Tombstone is true when a rollback arrived for a bet that was never posted
+	Tombstone bool `json:"tombstone,omitempty"`
+}
+
+// Round links the seamless transactions of one game round
+type Round struct {
+	ClientID     int           `json:"clientId"`
+	Address      string        `json:"address"`
+	RoundID      string        `json:"roundId"`
+	Status       string        `json:"status"`
+	Transactions []Transaction `json:"transactions"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	UpdatedAt    time.Time     `json:"updatedAt"`
+}
+
+// SeamlessBet debit the Wallet for a bet, a repeated providerTxId returns the original posting
+func (db *DB) SeamlessBet(r *SeamlessRequest) (*SeamlessResult, error) {
+	return db.seamless(r, SeamlessBet, func(tx *sql.Tx, res *SeamlessResult) error {
+		var tombstones int
+		err := tx.QueryRow("SELECT count(*) FROM seamless_tombstones WHERE client_id = $1 AND provider_tx_id = $2",
+			r.ClientID, r.ProviderTxID).Scan(&tombstones)
+		if err != nil {
+			return err
+		}
+		if tombstones > 0 {
+			return ErrBetRolledBack
+		}
+		if err = openRound(tx, r); err != nil {
+			return err
+		}
+		if !isBalanceEnoughForDebit(tx, r.ClientID, r.Address, r.Amount) {
+			return ErrInsufficientBalance
+		}
+
+		res.Transaction = r.transaction("dr", SeamlessBet)
+		res.Transaction.DrAmount = r.Amount
+
+		return postTransaction(tx, res.Transaction)
+	})
+}
+
+// SeamlessWin credit the Wallet for a win, a repeated providerTxId returns the original posting
+func (db *DB) SeamlessWin(r *SeamlessRequest) (*SeamlessResult, error) {
+	return db.seamless(r, SeamlessWin, func(tx *sql.Tx, res *SeamlessResult) error {
+		if err := openRound(tx, r); err != nil {
+			return err
+		}
+
+		res.Transaction = r.transaction("cr", SeamlessWin)
+		res.Transaction.CrAmount = r.Amount
+
+		return postTransaction(tx, res.Transaction)
+	})
+}
+
+// SeamlessRollback undo the bet referenced by ReferenceTxID. When the bet is unknown a
+// tombstone is recorded instead so the bet is refused if it arrives late.
+func (db *DB) SeamlessRollback(r *SeamlessRequest) (*SeamlessResult, error) {
+	return db.seamless(r, SeamlessRollback, func(tx *sql.Tx, res *SeamlessResult) error {
+		var tombstoned int
+		err := tx.QueryRow("SELECT count(*) FROM seamless_tombstones WHERE client_id = $1 AND rollback_tx_id = $2",
+			r.ClientID, r.ProviderTxID).Scan(&tombstoned)
+		if err != nil {
+			return err
+		}
+		if tombstoned > 0 {
+			// replay of a rollback that only left a tombstone
+			res.Tombstone = true
+			return nil
+		}
+
+		bet, err := lockTransaction(tx, "provider_tx_id", r.ClientID, r.Address, r.ReferenceTxID)
+		if err == ErrTransactionNotFound {
+			res.Tombstone = true
+			// another rollback of the same unknown bet already left the tombstone
+			var n int
+			err = tx.QueryRow("SELECT count(*) FROM seamless_tombstones WHERE client_id = $1 AND provider_tx_id = $2",
+				r.ClientID, r.ReferenceTxID).Scan(&n)
+			if err != nil || n > 0 {
+				return err
+			}
+			_, err = tx.Exec("INSERT INTO seamless_tombstones (client_id, address, provider_tx_id, round_id, "+
+				" rollback_tx_id, created_at) VALUES ($1, $2, $3, $4, $5, $6)",
+				r.ClientID, r.Address, r.ReferenceTxID, r.RoundID, r.ProviderTxID, time.Now().Local())
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if bet.MethodType != SeamlessBet {
+			return ErrTransactionNotFound
+		}
+
+		res.Transaction = r.transaction("", SeamlessRollback)
+		res.Transaction.RoundID = bet.RoundID
+
+		return reverseTransaction(tx, bet, 0, res.Transaction)
+	})
+}
+
+// EndRound close the game round, later bets and wins on it are refused
+func (db *DB) EndRound(id int, guid, roundID string) (*Round, error) {
+	r, err := db.Exec("UPDATE game_rounds SET status = $4, updated_at = $5 "+
+		" WHERE client_id = $1 AND address = $2 AND round_id = $3", id, guid, roundID, RoundClosed, time.Now().Local())
+	if err != nil {
+		return nil, err
+	}
+	if c, _ := r.RowsAffected(); c == 0 {
+		return nil, ErrRoundNotFound
+	}
+
+	return db.GetRound(id, roundID)
+}
+
+// GetRound return the game round with all its transactions
+func (db *DB) GetRound(id int, roundID string) (*Round, error) {
+	var round Round
+	err := db.QueryRow("SELECT client_id, address, round_id, status, created_at, updated_at "+
+		" FROM game_rounds WHERE client_id = $1 AND round_id = $2", id, roundID).Scan(
+		&round.ClientID, &round.Address, &round.RoundID, &round.Status, &round.CreatedAt, &round.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRoundNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT "+transactionColumns+" FROM transactions "+
+		" WHERE client_id = $1 AND round_id = $2 ORDER BY transaction_at, id", id, roundID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t Transaction
+		err := scanTransaction(rows, &t)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		round.Transactions = append(round.Transactions, t)
+	}
+
+	return &round, nil
+}
+
+// seamless run post in a database transaction with the Wallet locked. A providerTxId already
+// posted is answered with the original transaction, or ErrIdempotencyConflict if it differs.
+func (db *DB) seamless(r *SeamlessRequest, op string, post func(tx *sql.Tx, res *SeamlessResult) error) (*SeamlessResult, error) {
+	res := &SeamlessResult{ProviderTxID: r.ProviderTxID, RoundID: r.RoundID}
+
+	err := db.withTx(func(tx *sql.Tx) error {
+		if err := lockWallet(tx, r.ClientID, r.Address); err != nil {
+			return err
+		}
+
+		var posted Transaction
+		err := scanTransaction(tx.QueryRow("SELECT "+transactionColumns+" FROM transactions "+
+			" WHERE client_id = $1 AND provider_tx_id = $2", r.ClientID, r.ProviderTxID), &posted)
+		switch {
+		case err == sql.ErrNoRows:
+			err = post(tx, res)
+		case err == nil:
+			if posted.MethodType != op || posted.Address != r.Address || (r.Amount != 0 && posted.Amount() != r.Amount) {
+				return ErrIdempotencyConflict
+			}
+			res.Transaction = &posted
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRow("SELECT currency, balance FROM wallets WHERE client_id = $1 AND address = $2",
+			r.ClientID, r.Address).Scan(&res.Currency, &res.Balance)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// transaction build the Transaction posted for the request
+func (r *SeamlessRequest) transaction(transactionType, op string) *Transaction {
+	return &Transaction{
+		ClientID:        r.ClientID,
+		Address:         r.Address,
+		TransactionType: transactionType,
+		Currency:        r.Currency,
+		MethodType:      op,
+		Particulars:     r.Particulars,
+		ProviderTxID:    r.ProviderTxID,
+		RoundID:         r.RoundID,
+	}
+}
+
+// openRound create the round on its first operation, refuse it once ended or when it
+// was opened by another e-Wallet
+func openRound(tx *sql.Tx, r *SeamlessRequest) error {
+	var status, address string
+	now := time.Now().Local()
+	err := tx.QueryRow("INSERT INTO game_rounds (client_id, address, round_id, status, created_at, updated_at) "+
+		" VALUES ($1, $2, $3, $4, $5, $5) "+
+		" ON CONFLICT (client_id, round_id) DO UPDATE SET updated_at = $5 RETURNING status, address",
+		r.ClientID, r.Address, r.RoundID, RoundOpen, now).Scan(&status, &address)
+	if err != nil {
+		return err
+	}
+	if address != r.Address {
+		return ErrRoundOtherWallet
+	}
+	if status == RoundClosed {
+		return ErrRoundClosed
+	}
+
+	return nil
+}
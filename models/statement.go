@@ -0,0 +1,54 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Statement is the e-Wallet activity between From (inclusive) and To (exclusive)
+type Statement struct {
+	Address        string    `json:"address"`
+	Currency       string    `json:"currency"`
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	OpeningBalance Amount    `json:"openingBalance"`
+	TotalCredits   Amount    `json:"totalCredits"`
+	TotalDebits    Amount    `json:"totalDebits"`
+	ClosingBalance Amount    `json:"closingBalance"`
+	// Transactions are oldest first, NewBalance is the running balance
+	Transactions []Transaction `json:"transactions"`
+}
+
+// GetStatement build the e-Wallet statement of the period, the opening balance is the
+// running balance of the last transaction before from
+func (db *DB) GetStatement(id int, guid string, from, to time.Time) (*Statement, error) {
+	st := Statement{Address: guid, From: from, To: to}
+	err := db.QueryRow("SELECT currency FROM wallets WHERE client_id = $1 AND address = $2", id, guid).Scan(&st.Currency)
+	if err == sql.ErrNoRows {
+		return nil, ErrWalletNotActive
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.QueryRow("SELECT new_balance FROM transactions WHERE client_id = $1 AND address = $2 AND transaction_at < $3 "+
+		" ORDER BY transaction_at DESC, id DESC LIMIT 1", id, guid, from).Scan(&st.OpeningBalance)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	ts, err := db.GetAllTransactionByIDGUID(id, guid, from, to)
+	if err != nil {
+		return nil, err
+	}
+	// listing is latest first, a statement reads oldest first
+	st.Transactions = make([]Transaction, 0, len(ts))
+	for i := len(ts) - 1; i >= 0; i-- {
+		st.TotalCredits += ts[i].CrAmount
+		st.TotalDebits += ts[i].DrAmount
+		st.Transactions = append(st.Transactions, ts[i])
+	}
+	st.ClosingBalance = st.OpeningBalance + st.TotalCredits - st.TotalDebits
+
+	return &st, nil
+}
@@ -1,7 +1,7 @@
 package models
 
 import (
-	"log"
+	"database/sql"
 	"time"
 
 	"github.com/rs/xid"
@@ -13,55 +13,263 @@ type Transaction struct {
 	ClientID        int       `json:"clientId"`
 	Address         string    `json:"address"`
 	TransactionType string    `json:"transactionType"`
-	CrAmount        float64   `json:"crAmount"`
-	DrAmount        float64   `json:"drAmount"`
-	OldBalance      float64   `json:"oldBalance"`
-	NewBalance      float64   `json:"newBalance"`
+	Currency        string    `json:"currency"`
+	CrAmount        Amount    `json:"crAmount"`
+	DrAmount        Amount    `json:"drAmount"`
+	OldBalance      Amount    `json:"oldBalance"`
+	NewBalance      Amount    `json:"newBalance"`
 	MethodType      string    `json:"methodType"`
 	Particulars     string    `json:"particulars"`
 	ReferenceCode   string    `json:"referenceCode"`
 	TransactionAt   time.Time `json:"transactionAt"`
+
+	// ExternalReference is the client own reference, also used as idempotency key
+	ExternalReference string `json:"externalReference,omitempty"`
+	// TransferReference is shared by the dr and cr rows of a wallet to wallet transfer or exchange
+	TransferReference string `json:"transferReference,omitempty"`
+	// FXRate is the applied rate of both legs of a currency exchange
+	FXRate Rate `json:"fxRate,omitempty"`
+
+	// ReversalOf is the reference code of the transaction this row reverses
+	ReversalOf     string `json:"reversalOf,omitempty"`
+	ReversedAmount Amount `json:"reversedAmount"`
+	// ReversalStatus is none, partial or full, empty on reversal rows
+	ReversalStatus string `json:"reversalStatus,omitempty"`
+
+	// ProviderTxID and RoundID are set by the seamless gaming wallet operations
+	ProviderTxID string `json:"providerTxId,omitempty"`
+	RoundID      string `json:"roundId,omitempty"`
+
+	// Bucket is the balance bucket a credit goes to, or a debit draws from first.
+	// Buckets is the per-bucket breakdown of the posted amount.
+	Bucket  string          `json:"bucket,omitempty"`
+	Buckets BucketBreakdown `json:"buckets,omitempty"`
+
+	// ExpiresAt makes a credit expire, it is kept on the credit lots and not on the row
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// Fee is the fee charged on the posting, FeeOf is set on a fee dr to the row it charges for
+	Fee   *FeeBreakdown `json:"fee,omitempty"`
+	FeeOf string        `json:"feeOf,omitempty"`
+
+	// contra is the ledger account on the other side of the e-Wallet posting, client float when empty
+	contra string
+	// lot limits the lot consumption of a debit to the credit lot being expired
+	lot int
+	// keepBonus keeps the debit off the bonus bucket while a bonus grant is being wagered
+	keepBonus bool
+	// noLimits skips the limit checks on the postings the e-Wallet makes on its own
+	noLimits bool
+	// grantTerms are the wagering terms of a bonus credit, hashed with it for idempotency
+	grantTerms string
 }
 
 // CreateCreditTransaction create credit transaction for Client Subscribers/Users
+//
+// Deprecated: the row is written without touching the Wallet balance, use PostCreditTransaction
 func (db *DB) CreateCreditTransaction(transact *Transaction) (int, error) {
-	var lastInsertID int
+	return createCreditTransaction(db, transact)
+}
 
-	uid := xid.New()
-	refCode := "REF" + uid.String()
+// CreateDebitTransaction create dedit transaction for Client Subscribers/Users
+//
+// Deprecated: the row is written without touching the Wallet balance, use PostDebitTransaction
+func (db *DB) CreateDebitTransaction(transact *Transaction) (int, error) {
+	return createDebitTransaction(db, transact)
+}
 
+// PostCreditTransaction record the credit and update the Wallet balance in one database transaction,
+// a non empty idemKey that was already used returns the original transaction without posting again
+func (db *DB) PostCreditTransaction(transact *Transaction, idemKey string) (*Transaction, error) {
+	if err := checkClientKey(idemKey); err != nil {
+		return nil, err
+	}
+	err := db.withTx(func(tx *sql.Tx) error {
+		var err error
+		transact, err = postCredit(tx, transact, idemKey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transact, nil
+}
+
+// PostDebitTransaction check the balance, record the debit and update the Wallet balance in one database transaction,
+// idemKey works as in PostCreditTransaction
+func (db *DB) PostDebitTransaction(transact *Transaction, idemKey string) (*Transaction, error) {
+	if err := checkClientKey(idemKey); err != nil {
+		return nil, err
+	}
+	err := db.withTx(func(tx *sql.Tx) error {
+		var err error
+		transact, err = postDebit(tx, transact, idemKey)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return transact, nil
+}
+
+// postCredit is PostCreditTransaction inside tx, a replayed key returns the original transaction
+func postCredit(tx *sql.Tx, transact *Transaction, idemKey string) (*Transaction, error) {
 	transact.TransactionType = "cr"
-	transact.ReferenceCode = refCode
-	transact.TransactionAt = time.Now().Local()
+	transact.Fee, transact.FeeOf = nil, ""
+	// a plain posting is never a reversal, a leg of a transfer or exchange, or a seamless operation
+	transact.ReversalOf, transact.TransferReference, transact.FXRate = "", "", 0
+	transact.ProviderTxID, transact.RoundID = "", ""
+
+	replay, err := claimIdempotencyKey(tx, transact, idemKey)
+	if err != nil || replay != nil {
+		return replay, err
+	}
+	if err = lockWallet(tx, transact.ClientID, transact.Address); err != nil {
+		return nil, err
+	}
+	if transact.Fee, err = quoteFee(tx, transact); err != nil {
+		return nil, err
+	}
+	if transact.Fee != nil && transact.Fee.Netted {
+		transact.CrAmount = transact.Fee.Net
+	}
+	if err = postTransaction(tx, transact); err != nil {
+		return nil, err
+	}
+	if err = chargeFee(tx, transact); err != nil {
+		return nil, err
+	}
+
+	return transact, saveIdempotencyKey(tx, transact, idemKey)
+}
+
+// postDebit is PostDebitTransaction inside tx, a replayed key returns the original transaction
+func postDebit(tx *sql.Tx, transact *Transaction, idemKey string) (*Transaction, error) {
+	transact.TransactionType = "dr"
+	transact.Fee, transact.FeeOf = nil, ""
+	// a plain posting is never a reversal, a leg of a transfer or exchange, or a seamless operation
+	transact.ReversalOf, transact.TransferReference, transact.FXRate = "", "", 0
+	transact.ProviderTxID, transact.RoundID = "", ""
+	transact.keepBonus = true
 
-	err := db.QueryRow("INSERT INTO transactions (client_id, address, transaction_type, cr_amount, "+
-		" method_type, particulars, reference_code, transaction_at) "+
-		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;",
-		transact.ClientID, transact.Address, transact.TransactionType, transact.CrAmount,
-		transact.MethodType, transact.Particulars, transact.ReferenceCode, transact.TransactionAt).Scan(&lastInsertID)
+	replay, err := claimIdempotencyKey(tx, transact, idemKey)
+	if err != nil || replay != nil {
+		return replay, err
+	}
+	if err = lockWallet(tx, transact.ClientID, transact.Address); err != nil {
+		return nil, err
+	}
+	if transact.Fee, err = quoteFee(tx, transact); err != nil {
+		return nil, err
+	}
+	total := transact.DrAmount
+	if transact.Fee != nil {
+		total = transact.Fee.Net
+	}
+	locked, err := lockedBonus(tx, transact.ClientID, transact.Address)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	// balance is read under the row lock so no other debit can spend it meanwhile
+	if !isBalanceEnoughForDebit(tx, transact.ClientID, transact.Address, total+locked) {
+		return nil, ErrInsufficientBalance
+	}
+	if err = postTransaction(tx, transact); err != nil {
+		return nil, err
+	}
+	if err = chargeFee(tx, transact); err != nil {
+		return nil, err
 	}
 
-	return lastInsertID, nil
+	return transact, saveIdempotencyKey(tx, transact, idemKey)
 }
 
-// CreateDebitTransaction create dedit transaction for Client Subscribers/Users
-func (db *DB) CreateDebitTransaction(transact *Transaction) (int, error) {
+// postTransaction check the limits, apply the cr/dr to the Wallet balance, write the row with
+// the running balance and its ledger journal entry. The caller must hold the Wallet row lock
+// and have done the balance checks.
+func postTransaction(tx *sql.Tx, transact *Transaction) error {
+	var oldBalance, newBalance *Amount
+
+	_, err := walletCurrency(tx, transact.ClientID, transact.Address, &transact.Currency, transact.Amount())
+	if err != nil {
+		return err
+	}
+	if !transact.noLimits {
+		if err = checkLimits(tx, transact); err != nil {
+			return err
+		}
+	}
+
+	if transact.TransactionType == "cr" {
+		transact.DrAmount = 0
+		oldBalance, newBalance, err = creditWallet(tx, transact.ClientID, transact.Address, transact.CrAmount)
+	} else {
+		transact.CrAmount = 0
+		oldBalance, newBalance, err = debitWallet(tx, transact.ClientID, transact.Address, transact.DrAmount)
+	}
+	if err != nil {
+		return err
+	}
+	transact.OldBalance = *oldBalance
+	transact.NewBalance = *newBalance
+	if err = applyBuckets(tx, transact); err != nil {
+		return err
+	}
+
+	transact.ID, err = insertTransaction(tx, transact)
+	if err != nil {
+		return err
+	}
+	transact.setReversalStatus()
+	if err = applyLots(tx, transact); err != nil {
+		return err
+	}
+	if err = applyBonusSpend(tx, transact); err != nil {
+		return err
+	}
+	if err = applyWagering(tx, transact); err != nil {
+		return err
+	}
+
+	return journalTransaction(tx, transact)
+}
+
+func createCreditTransaction(q querier, transact *Transaction) (int, error) {
+	transact.TransactionType = "cr"
+	transact.DrAmount = 0
+
+	return insertTransaction(q, transact)
+}
+
+func createDebitTransaction(q querier, transact *Transaction) (int, error) {
+	transact.TransactionType = "dr"
+	transact.CrAmount = 0
+
+	return insertTransaction(q, transact)
+}
+
+// insertTransaction write the transaction row with a new reference code
+func insertTransaction(q querier, transact *Transaction) (int, error) {
 	var lastInsertID int
 
 	uid := xid.New()
 	refCode := "REF" + uid.String()
 
-	transact.TransactionType = "dr"
 	transact.ReferenceCode = refCode
 	transact.TransactionAt = time.Now().Local()
 
-	err := db.QueryRow("INSERT INTO transactions (client_id, address, transaction_type, dr_amount, "+
-		" method_type, particulars, reference_code, transaction_at) "+
-		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;",
-		transact.ClientID, transact.Address, transact.TransactionType, transact.DrAmount,
-		transact.MethodType, transact.Particulars, transact.ReferenceCode, transact.TransactionAt).Scan(&lastInsertID)
+	err := q.QueryRow("INSERT INTO transactions (client_id, address, transaction_type, currency, cr_amount, dr_amount, "+
+		" old_balance, new_balance, method_type, particulars, reference_code, external_reference, transfer_reference, "+
+		" fx_rate, reversal_of, provider_tx_id, round_id, buckets, fee, fee_of, transaction_at) "+
+		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21) "+
+		" RETURNING id;",
+		transact.ClientID, transact.Address, transact.TransactionType, transact.Currency, transact.CrAmount, transact.DrAmount,
+		transact.OldBalance, transact.NewBalance,
+		transact.MethodType, transact.Particulars, transact.ReferenceCode, transact.ExternalReference,
+		transact.TransferReference, transact.FXRate, transact.ReversalOf, transact.ProviderTxID, transact.RoundID,
+		transact.Buckets, transact.Fee, transact.FeeOf, transact.TransactionAt).Scan(&lastInsertID)
 	if err != nil {
 		return 0, err
 	}
@@ -69,13 +277,82 @@ func (db *DB) CreateDebitTransaction(transact *Transaction) (int, error) {
 	return lastInsertID, nil
 }
 
+// transactionColumns is the select list read by scanTransaction
+const transactionColumns = "id, client_id, address, transaction_type, currency, cr_amount, dr_amount, " +
+	" old_balance, new_balance, method_type, " +
+	" particulars, reference_code, external_reference, transfer_reference, fx_rate, reversal_of, reversed_amount, " +
+	" provider_tx_id, round_id, buckets, fee, fee_of, transaction_at"
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTransaction(r rowScanner, t *Transaction) error {
+	err := r.Scan(&t.ID, &t.ClientID, &t.Address, &t.TransactionType, &t.Currency, &t.CrAmount, &t.DrAmount,
+		&t.OldBalance, &t.NewBalance, &t.MethodType, &t.Particulars, &t.ReferenceCode, &t.ExternalReference,
+		&t.TransferReference, &t.FXRate, &t.ReversalOf, &t.ReversedAmount, &t.ProviderTxID, &t.RoundID, &t.Buckets,
+		&t.Fee, &t.FeeOf, &t.TransactionAt)
+	if err != nil {
+		return err
+	}
+	t.setReversalStatus()
+
+	return nil
+}
+
+// Amount return the posted amount whatever the transaction type
+func (t *Transaction) Amount() Amount {
+	if t.TransactionType == "cr" {
+		return t.CrAmount
+	}
+
+	return t.DrAmount
+}
+
+func (t *Transaction) setReversalStatus() {
+	switch {
+	case t.ReversalOf != "":
+		t.ReversalStatus = ""
+	case t.ReversedAmount == 0:
+		t.ReversalStatus = "none"
+	case t.ReversedAmount < t.Amount():
+		t.ReversalStatus = "partial"
+	default:
+		t.ReversalStatus = "full"
+	}
+}
+
 // GetTransactionByID return a transaction object
 func (db *DB) GetTransactionByID(id int) (*Transaction, error) {
+	return getTransactionByID(db, id)
+}
+
+// GetTransactionByReference return the Client transaction with the reference code, or else the
+// latest one with the client external reference, together with its Wallet
+func (db *DB) GetTransactionByReference(id int, ref string) (*Transaction, *Wallet, error) {
+	var t Transaction
+	err := scanTransaction(db.QueryRow("SELECT "+transactionColumns+" FROM transactions "+
+		" WHERE client_id = $1 AND (reference_code = $2 OR external_reference = $2) "+
+		" ORDER BY reference_code = $2 DESC, transaction_at DESC, id DESC LIMIT 1", id, ref), &t)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrTransactionNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wallet, err := db.GetWalletByIDGUID(id, t.Address)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &t, wallet, nil
+}
+
+func getTransactionByID(q querier, id int) (*Transaction, error) {
 	var t Transaction
-	err := db.QueryRow("SELECT client_id, address, transaction_type, cr_amount, dr_amount, method_type, "+
-		" particulars, reference_code, transaction_at "+
-		" FROM transactions WHERE id = $1", id).Scan(&t.ClientID, &t.Address, &t.TransactionType, &t.CrAmount, &t.DrAmount,
-		&t.MethodType, &t.Particulars, &t.ReferenceCode, &t.TransactionAt)
+	err := scanTransaction(q.QueryRow("SELECT "+transactionColumns+" FROM transactions WHERE id = $1", id), &t)
 	if err != nil {
 		return nil, err
 	}
@@ -83,25 +360,108 @@ func (db *DB) GetTransactionByID(id int) (*Transaction, error) {
 	return &t, nil
 }
 
-// GetAllTransactionByIDGUID return all Transaction for the Client e-Wallet address
-func (db *DB) GetAllTransactionByIDGUID(id int, guid string) ([]Transaction, error) {
+// GetAllTransactionByIDGUID return the Transaction for the Client e-Wallet address posted from
+// (inclusive) to (exclusive), latest first. A zero from or to leaves that side open.
+func (db *DB) GetAllTransactionByIDGUID(id int, guid string, from, to time.Time) ([]Transaction, error) {
 	var ts []Transaction
-	rows, err := db.Query("SELECT client_id, address, transaction_type, cr_amount, dr_amount, method_type, "+
-		" particulars, reference_code, transaction_at FROM transactions "+
-		" WHERE client_id = $1 AND address = $2 ORDER BY transaction_at DESC", id, guid)
+	rows, err := db.Query("SELECT "+transactionColumns+" FROM transactions "+
+		" WHERE client_id = $1 AND address = $2 "+
+		" AND ($3::timestamp IS NULL OR transaction_at >= $3) AND ($4::timestamp IS NULL OR transaction_at < $4) "+
+		" ORDER BY transaction_at DESC, id DESC", id, guid, nullTime(from), nullTime(to))
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		var t Transaction
-		err := rows.Scan(&t.ClientID, &t.Address, &t.TransactionType, &t.CrAmount, &t.DrAmount,
-			&t.MethodType, &t.Particulars, &t.ReferenceCode, &t.TransactionAt)
+		// a skipped row would leave the statement totals wrong
+		if err := scanTransaction(rows, &t); err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+
+	return ts, rows.Err()
+}
+
+// nullTime pass a zero time as SQL NULL
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+
+	return t
+}
+
+// TransactionFilter narrows a transaction listing, empty fields do not filter.
+// From is inclusive, To is exclusive and the amount range applies to the cr or dr amount.
+type TransactionFilter struct {
+	From            time.Time
+	To              time.Time
+	TransactionType string
+	MethodType      string
+	ReferenceCode   string
+	MinAmount       *Amount
+	MaxAmount       *Amount
+}
+
+// GetTransactionPageByIDGUID return one page of the Client e-Wallet transactions matching f,
+// sorted by transaction time, latest first unless the page request asks otherwise
+func (db *DB) GetTransactionPageByIDGUID(id int, guid string, f *TransactionFilter, pr PageRequest) ([]Transaction, *Paging, error) {
+	k, err := pr.keyset()
+	if err != nil {
+		return nil, nil, err
+	}
+	afterAt, afterID := k.args()
+
+	var minAmount, maxAmount interface{}
+	if f.MinAmount != nil {
+		minAmount = *f.MinAmount
+	}
+	if f.MaxAmount != nil {
+		maxAmount = *f.MaxAmount
+	}
+
+	rows, err := db.Query("SELECT "+transactionColumns+" FROM transactions "+
+		" WHERE client_id = $1 AND address = $2 "+
+		" AND ($3::timestamp IS NULL OR transaction_at >= $3) AND ($4::timestamp IS NULL OR transaction_at < $4) "+
+		" AND ($5 = '' OR transaction_type = $5) AND ($6 = '' OR method_type = $6) AND ($7 = '' OR reference_code = $7) "+
+		" AND ($8::numeric IS NULL OR cr_amount + dr_amount >= $8) AND ($9::numeric IS NULL OR cr_amount + dr_amount <= $9) "+
+		" AND ($10::timestamp IS NULL OR (transaction_at, id) "+k.op+" ($10, $11)) "+
+		" ORDER BY transaction_at "+k.order+", id "+k.order+" LIMIT $12",
+		id, guid, nullTime(f.From), nullTime(f.To), f.TransactionType, f.MethodType, f.ReferenceCode,
+		minAmount, maxAmount, afterAt, afterID, k.limit+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var ts []Transaction
+	for rows.Next() {
+		var t Transaction
+		err := scanTransaction(rows, &t)
 		if err != nil {
-			log.Println(err)
-			continue
+			return nil, nil, err
 		}
 		ts = append(ts, t)
 	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	n := len(ts)
+	if n > k.limit {
+		ts = ts[:k.limit]
+	}
+	if k.backwards() {
+		for i, j := 0, len(ts)-1; i < j; i, j = i+1, j-1 {
+			ts[i], ts[j] = ts[j], ts[i]
+		}
+	}
+	if len(ts) == 0 {
+		return ts, k.paging(0, time.Time{}, 0, time.Time{}, 0), nil
+	}
+	first, last := ts[0], ts[len(ts)-1]
 
-	return ts, nil
+	return ts, k.paging(n, first.TransactionAt, first.ID, last.TransactionAt, last.ID), nil
 }
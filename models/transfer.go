@@ -0,0 +1,89 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/rs/xid"
+)
+
+// ErrSameWallet is returned when a transfer source and destination are the same e-Wallet
+var ErrSameWallet = errors.New("Source and destination must be different e-Wallets")
+
+// Transfer moves funds between two e-Wallets of the same client
+type Transfer struct {
+	ClientID          int          `json:"clientId"`
+	Source            string       `json:"source"`
+	Destination       string       `json:"destination"`
+	Currency          string       `json:"currency"`
+	Amount            Amount       `json:"amount"`
+	MethodType        string       `json:"methodType"`
+	Particulars       string       `json:"particulars"`
+	TransferReference string       `json:"transferReference"`
+	Debit             *Transaction `json:"debit,omitempty"`
+	Credit            *Transaction `json:"credit,omitempty"`
+}
+
+// PostTransfer write the paired dr/cr transactions of the transfer and update
+// both Wallet balances in one database transaction
+func (db *DB) PostTransfer(transfer *Transfer) error {
+	if transfer.Source == transfer.Destination {
+		return ErrSameWallet
+	}
+
+	transfer.TransferReference = "TRF" + xid.New().String()
+	dr := &Transaction{
+		ClientID:          transfer.ClientID,
+		Address:           transfer.Source,
+		TransactionType:   "dr",
+		Currency:          transfer.Currency,
+		DrAmount:          transfer.Amount,
+		MethodType:        transfer.MethodType,
+		Particulars:       transfer.Particulars,
+		TransferReference: transfer.TransferReference,
+		keepBonus:         true,
+	}
+	cr := &Transaction{
+		ClientID:          transfer.ClientID,
+		Address:           transfer.Destination,
+		TransactionType:   "cr",
+		CrAmount:          transfer.Amount,
+		MethodType:        transfer.MethodType,
+		Particulars:       transfer.Particulars,
+		TransferReference: transfer.TransferReference,
+	}
+
+	err := db.withTx(func(tx *sql.Tx) error {
+		err := lockWalletPair(tx, transfer.ClientID, transfer.Source, transfer.Destination)
+		if err != nil {
+			return err
+		}
+		if !isWalletActive(tx, transfer.ClientID, transfer.Source) || !isWalletActive(tx, transfer.ClientID, transfer.Destination) {
+			return ErrWalletNotActive
+		}
+		// bonus money still being wagered stays in the source
+		locked, err := lockedBonus(tx, transfer.ClientID, transfer.Source)
+		if err != nil {
+			return err
+		}
+		if !isBalanceEnoughForDebit(tx, transfer.ClientID, transfer.Source, transfer.Amount+locked) {
+			return ErrInsufficientBalance
+		}
+		if err = postTransaction(tx, dr); err != nil {
+			return err
+		}
+		// both legs must be in the source currency
+		transfer.Currency = dr.Currency
+		cr.Currency = dr.Currency
+
+		return postTransaction(tx, cr)
+	})
+	if err != nil {
+		return err
+	}
+
+	transfer.Debit = dr
+	transfer.Credit = cr
+
+	return nil
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"database/sql"
+	"errors"
 	"log"
 	"time"
 
@@ -13,37 +15,201 @@ type Wallet struct {
 	Address   string    `json:"address"`
 	ClientID  int       `json:"clientID"`
 	UserID    int       `json:"userID"`
-	Balance   float64   `json:"balance"`
+	Currency  string    `json:"currency"`
+	Balance   Amount    `json:"balance"`
 	FundType  string    `json:"fundType"`
 	Tag       string    `json:"tag"`
 	IsActive  *bool     `json:"isActive,omitempty"`
 	CreatedAT time.Time `json:"createdAt,omitempty"`
 	UpdatedAT time.Time `json:"updatedAt,omitempty"`
+
+	// HeldBalance is reserved by authorized holds, AvailableBalance is what debits can still spend
+	HeldBalance      Amount `json:"heldBalance"`
+	AvailableBalance Amount `json:"availableBalance"`
+
+	// CreditLimit is how far the balance may go negative, OverdraftUsed is the drawn part of it.
+	// With OverdraftFirst credits repay the overdraft before adding to the spendable money.
+	CreditLimit      Amount `json:"creditLimit"`
+	OverdraftUsed    Amount `json:"overdraftUsed"`
+	OverdraftFirst   bool   `json:"overdraftFirst"`
+	AvailableToSpend Amount `json:"availableToSpend"`
+
+	// Expiring is the credit money still to lapse by day, only filled on the single wallet view
+	Expiring []ExpiringAmount `json:"expiring,omitempty"`
 }
 
-// CreateWallet create wallet for a Subscribers/Users of the Client
+// ErrWalletExists is returned when the client allows one wallet per user and fund type and it already exists
+var ErrWalletExists = errors.New("User already has an e-Wallet of this fund type")
+
+// CreateWallet create wallet for a Subscribers/Users of the Client,
+// without a currency the wallet gets the client default currency
 func (db *DB) CreateWallet(wallet *Wallet) (int, error) {
-	var lastInsertID int
+	err := db.withTx(func(tx *sql.Tx) error {
+		return createWallet(tx, wallet)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return wallet.ID, nil
+}
+
+// GetOrCreateWallet return the user wallet of the fund type, creating it from wallet when the
+// user has none yet. created tells which of the two happened.
+func (db *DB) GetOrCreateWallet(wallet *Wallet) (w *Wallet, created bool, err error) {
+	w = &Wallet{}
+	err = db.withTx(func(tx *sql.Tx) error {
+		// serialize the lookups of the same user so two callers do not both create
+		if err := lockUserWallets(tx, wallet.ClientID, wallet.UserID); err != nil {
+			return err
+		}
+		err := scanWallet(tx.QueryRow("SELECT "+walletColumns+" FROM wallets "+
+			" WHERE client_id = $1 AND user_id = $2 AND fund_type = $3 ORDER BY created_at, id LIMIT 1",
+			wallet.ClientID, wallet.UserID, wallet.FundType), w)
+		if err != sql.ErrNoRows {
+			return err
+		}
+
+		created = true
+		if err = createWallet(tx, wallet); err != nil {
+			return err
+		}
+
+		return scanWallet(tx.QueryRow("SELECT "+walletColumns+" FROM wallets WHERE id = $1", wallet.ID), w)
+	})
+	if err != nil {
+		return nil, false, err
+	}
 
+	return w, created, nil
+}
+
+// GetAllWalletByUserID return the wallets of the Client user, fundType narrows them when not empty
+func (db *DB) GetAllWalletByUserID(id, userID int, fundType string) ([]Wallet, error) {
+	rows, err := db.Query("SELECT "+walletColumns+" FROM wallets WHERE client_id = $1 AND user_id = $2 "+
+		" AND ($3 = '' OR fund_type = $3) ORDER BY created_at, id", id, userID, fundType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wallets []Wallet
+	for rows.Next() {
+		var wallet Wallet
+		err := scanWallet(rows, &wallet)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		wallets = append(wallets, wallet)
+	}
+
+	return wallets, nil
+}
+
+// createWallet insert the wallet and post its opening balance, wallet.ID is set on success
+func createWallet(tx *sql.Tx, wallet *Wallet) error {
 	cAt := time.Now().Local()
 	uAt := time.Now().Local()
 	uid := xid.New()
 
-	err := db.QueryRow("INSERT INTO wallets (address, client_id, user_id, balance, fund_type, tag, created_at, updated_at) "+
-		" VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;",
-		uid.String(), wallet.ClientID, wallet.UserID, wallet.Balance, wallet.FundType, wallet.Tag, cAt, uAt).Scan(&lastInsertID)
+	var defaultCurrency string
+	var unique bool
+	err := tx.QueryRow("SELECT default_currency, unique_fund_type FROM clients WHERE id = $1", wallet.ClientID).Scan(
+		&defaultCurrency, &unique)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	if wallet.Currency == "" {
+		wallet.Currency = defaultCurrency
+	}
+	c, err := getCurrency(tx, wallet.Currency)
+	if err != nil {
+		return err
+	}
+	wallet.Currency = c.Code
+	if !c.IsValidAmount(wallet.Balance) || !c.IsValidAmount(wallet.CreditLimit) {
+		return ErrAmountPrecision
+	}
+	if wallet.CreditLimit < 0 {
+		return ErrInvalidAmount
+	}
+	// a negative opening balance is an overdraft and must fit in the credit line
+	if wallet.Balance < -wallet.CreditLimit {
+		return ErrInsufficientBalance
+	}
+
+	if unique {
+		if err = lockUserWallets(tx, wallet.ClientID, wallet.UserID); err != nil {
+			return err
+		}
+		var n int
+		err = tx.QueryRow("SELECT count(*) FROM wallets WHERE client_id = $1 AND user_id = $2 AND fund_type = $3",
+			wallet.ClientID, wallet.UserID, wallet.FundType).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrWalletExists
+		}
+	}
+
+	err = tx.QueryRow("INSERT INTO wallets (address, client_id, user_id, currency, balance, fund_type, tag, "+
+		" credit_limit, overdraft_first, created_at, updated_at) "+
+		" VALUES ($1, $2, $3, $4, 0, $5, $6, $7, $8, $9, $10) RETURNING id;",
+		uid.String(), wallet.ClientID, wallet.UserID, wallet.Currency, wallet.FundType, wallet.Tag,
+		wallet.CreditLimit, wallet.OverdraftFirst, cAt, uAt).Scan(&wallet.ID)
+	if err != nil || wallet.Balance == 0 {
+		return err
 	}
 
-	return lastInsertID, nil
+	// the opening balance is posted like any credit so the transactions and the ledger explain it
+	opening := &Transaction{
+		ClientID:        wallet.ClientID,
+		Address:         uid.String(),
+		TransactionType: "cr",
+		Currency:        wallet.Currency,
+		CrAmount:        wallet.Balance,
+		MethodType:      "opening",
+		Particulars:     "opening balance",
+	}
+	if wallet.Balance < 0 {
+		// the wallet has no money of its own yet, debitWallet draws the whole debit as overdraft_used
+		opening.TransactionType = "dr"
+		opening.CrAmount, opening.DrAmount = 0, -wallet.Balance
+		wallet.OverdraftUsed = opening.DrAmount
+	}
+
+	return postTransaction(tx, opening)
+}
+
+// lockUserWallets take a transaction lock on the wallets of one Client user
+func lockUserWallets(tx *sql.Tx, id, userID int) error {
+	_, err := tx.Exec("SELECT pg_advisory_xact_lock($1, $2)", id, userID)
+
+	return err
+}
+
+// walletColumns is the select list read by scanWallet
+const walletColumns = "id, address, client_id, user_id, currency, balance, held_balance, fund_type, tag, is_active, " +
+	" credit_limit, overdraft_used, overdraft_first, created_at, updated_at"
+
+func scanWallet(r rowScanner, w *Wallet) error {
+	err := r.Scan(&w.ID, &w.Address, &w.ClientID, &w.UserID, &w.Currency, &w.Balance, &w.HeldBalance, &w.FundType, &w.Tag,
+		&w.IsActive, &w.CreditLimit, &w.OverdraftUsed, &w.OverdraftFirst, &w.CreatedAT, &w.UpdatedAT)
+	if err != nil {
+		return err
+	}
+	w.AvailableBalance = w.Balance - w.HeldBalance
+	w.AvailableToSpend = w.AvailableBalance + w.CreditLimit
+
+	return nil
 }
 
 // GetWalletByID return the Wallet Object
 func (db *DB) GetWalletByID(id int) (*Wallet, error) {
 	var wallet Wallet
-	err := db.QueryRow("SELECT address, client_id, user_id, balance, fund_type, tag FROM wallets WHERE id = $1", id).Scan(
-		&wallet.Address, &wallet.ClientID, &wallet.UserID, &wallet.Balance, &wallet.FundType, &wallet.Tag)
+	err := scanWallet(db.QueryRow("SELECT "+walletColumns+" FROM wallets WHERE id = $1", id), &wallet)
 	if err != nil {
 		return nil, err
 	}
@@ -54,9 +220,12 @@ func (db *DB) GetWalletByID(id int) (*Wallet, error) {
 // GetWalletByIDGUID returns a Wallet Object
 func (db *DB) GetWalletByIDGUID(id int, guid string) (*Wallet, error) {
 	var wallet Wallet
-	err := db.QueryRow("SELECT address, client_id, user_id, balance, fund_type, tag, is_active "+
-		" FROM wallets WHERE client_id = $1 AND address = $2", id, guid).Scan(
-		&wallet.Address, &wallet.ClientID, &wallet.UserID, &wallet.Balance, &wallet.FundType, &wallet.Tag, &wallet.IsActive)
+	err := scanWallet(db.QueryRow("SELECT "+walletColumns+
+		" FROM wallets WHERE client_id = $1 AND address = $2", id, guid), &wallet)
+	if err != nil {
+		return nil, err
+	}
+	wallet.Expiring, err = getExpiringAmounts(db, id, guid)
 	if err != nil {
 		return nil, err
 	}
@@ -66,15 +235,16 @@ func (db *DB) GetWalletByIDGUID(id int, guid string) (*Wallet, error) {
 
 // GetAllWallet returns all Wallet of the Client
 func (db *DB) GetAllWallet(id int) ([]Wallet, error) {
-	rows, err := db.Query("SELECT address, client_id, user_id, balance, fund_type, tag, is_active FROM wallets WHERE client_id = $1", id)
+	rows, err := db.Query("SELECT "+walletColumns+" FROM wallets WHERE client_id = $1", id)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	var wallets []Wallet
 	for rows.Next() {
 		var wallet Wallet
-		err := rows.Scan(&wallet.Address, &wallet.ClientID, &wallet.UserID, &wallet.Balance, &wallet.FundType, &wallet.Tag, &wallet.IsActive)
+		err := scanWallet(rows, &wallet)
 		if err != nil {
 			log.Println(err)
 			continue
@@ -85,19 +255,133 @@ func (db *DB) GetAllWallet(id int) ([]Wallet, error) {
 	return wallets, nil
 }
 
-// UpdateWalletByIDGUID updates the Wallet Info
+// WalletFilter narrows a wallet listing, empty fields do not filter
+type WalletFilter struct {
+	UserID     int
+	FundType   string
+	Tag        string
+	IsActive   *bool
+	MinBalance *Amount
+	MaxBalance *Amount
+}
+
+// GetWalletPage return one page of the Client wallets matching f, sorted by creation time
+func (db *DB) GetWalletPage(id int, f *WalletFilter, pr PageRequest) ([]Wallet, *Paging, error) {
+	k, err := pr.keyset()
+	if err != nil {
+		return nil, nil, err
+	}
+	afterAt, afterID := k.args()
+
+	var isActive, minBalance, maxBalance interface{}
+	if f.IsActive != nil {
+		isActive = *f.IsActive
+	}
+	if f.MinBalance != nil {
+		minBalance = *f.MinBalance
+	}
+	if f.MaxBalance != nil {
+		maxBalance = *f.MaxBalance
+	}
+
+	rows, err := db.Query("SELECT "+walletColumns+" FROM wallets WHERE client_id = $1 "+
+		" AND ($2 = 0 OR user_id = $2) AND ($3 = '' OR fund_type = $3) AND ($4 = '' OR tag = $4) "+
+		" AND ($5::boolean IS NULL OR is_active = $5) "+
+		" AND ($6::numeric IS NULL OR balance >= $6) AND ($7::numeric IS NULL OR balance <= $7) "+
+		" AND ($8::timestamp IS NULL OR (created_at, id) "+k.op+" ($8, $9)) "+
+		" ORDER BY created_at "+k.order+", id "+k.order+" LIMIT $10",
+		id, f.UserID, f.FundType, f.Tag, isActive, minBalance, maxBalance, afterAt, afterID, k.limit+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var wallets []Wallet
+	for rows.Next() {
+		var wallet Wallet
+		err := scanWallet(rows, &wallet)
+		if err != nil {
+			return nil, nil, err
+		}
+		wallets = append(wallets, wallet)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	n := len(wallets)
+	if n > k.limit {
+		wallets = wallets[:k.limit]
+	}
+	if k.backwards() {
+		for i, j := 0, len(wallets)-1; i < j; i, j = i+1, j-1 {
+			wallets[i], wallets[j] = wallets[j], wallets[i]
+		}
+	}
+	if len(wallets) == 0 {
+		return wallets, k.paging(0, time.Time{}, 0, time.Time{}, 0), nil
+	}
+	first, last := wallets[0], wallets[len(wallets)-1]
+
+	return wallets, k.paging(n, first.CreatedAT, first.ID, last.CreatedAT, last.ID), nil
+}
+
+// UpdateWalletByIDGUID updates the Wallet Info, a new fund type is checked against the client
+// catalog and, for a client with unique fund types, against the other wallets of the user
 func (db *DB) UpdateWalletByIDGUID(id int, guid string, wallet *Wallet) (int64, error) {
 	uAt := time.Now().Local()
 
-	r, err := db.Exec("UPDATE wallets SET tag = $3, fund_type = $4, is_active = $5, updated_at = $6 "+
-		" WHERE client_id = $1 AND address = $2;", id, guid, &wallet.Tag, &wallet.FundType, &wallet.IsActive, uAt)
+	var c int64
+	err := db.withTx(func(tx *sql.Tx) error {
+		var userID int
+		var fundType string
+		err := tx.QueryRow("SELECT user_id, fund_type FROM wallets WHERE client_id = $1 AND address = $2",
+			id, guid).Scan(&userID, &fundType)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if wallet.FundType != fundType {
+			if err = checkFundType(tx, id, wallet.FundType); err != nil {
+				return err
+			}
+			var unique bool
+			err = tx.QueryRow("SELECT unique_fund_type FROM clients WHERE id = $1", id).Scan(&unique)
+			if err != nil {
+				return err
+			}
+			if unique {
+				// same lock as createWallet so a concurrent create can not take the fund type
+				if err = lockUserWallets(tx, id, userID); err != nil {
+					return err
+				}
+				var n int
+				err = tx.QueryRow("SELECT count(*) FROM wallets WHERE client_id = $1 AND user_id = $2 AND fund_type = $3",
+					id, userID, wallet.FundType).Scan(&n)
+				if err != nil {
+					return err
+				}
+				if n > 0 {
+					return ErrWalletExists
+				}
+			}
+		}
+
+		r, err := tx.Exec("UPDATE wallets SET tag = $3, fund_type = $4, is_active = $5, updated_at = $6 "+
+			" WHERE client_id = $1 AND address = $2;", id, guid, &wallet.Tag, &wallet.FundType, &wallet.IsActive, uAt)
+		if err != nil {
+			return err
+		}
+		c, _ = r.RowsAffected()
+
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
-	c, err := r.RowsAffected()
-	if err != nil {
-		return 0, nil
-	}
 
 	return c, nil
 }
@@ -112,52 +396,92 @@ func (db *DB) GetWalletStatusByIDGUID(id int, guid string) *bool {
 
 // IsWalletActiveByIDGUID check if Wallet is active
 func (db *DB) IsWalletActiveByIDGUID(id int, guid string) bool {
+	return isWalletActive(db, id, guid)
+}
+
+// CreditWalletByIDGUID credit the wallet return newbalance or error
+func (db *DB) CreditWalletByIDGUID(id int, guid string, amt Amount) (*Amount, *Amount, error) {
+	return creditWallet(db, id, guid, amt)
+}
+
+// DebitWalletByIDGUID debit the wallet return newbalance or error
+func (db *DB) DebitWalletByIDGUID(id int, guid string, amt Amount) (*Amount, *Amount, error) {
+	return debitWallet(db, id, guid, amt)
+}
+
+// IsBalanceEnoughForDebit return bool if have enough balance for debit request
+func (db *DB) IsBalanceEnoughForDebit(id int, guid string, amt Amount) bool {
+	return isBalanceEnoughForDebit(db, id, guid, amt)
+}
+
+// lockWallet lock the Wallet row until the transaction ends, error if not found or inactive
+func lockWallet(tx *sql.Tx, id int, guid string) error {
 	var active bool
-	db.QueryRow("SELECT is_active FROM wallets WHERE client_id = $1 AND address = $2", id, guid).Scan(&active)
+	err := tx.QueryRow("SELECT is_active FROM wallets WHERE client_id = $1 AND address = $2 FOR UPDATE", id, guid).Scan(&active)
+	if err == sql.ErrNoRows || (err == nil && !active) {
+		return ErrWalletNotActive
+	}
+
+	return err
+}
+
+// lockWalletPair lock two Wallet rows in address order so opposite requests can not deadlock
+func lockWalletPair(tx *sql.Tx, id int, guidA, guidB string) error {
+	_, err := tx.Exec("SELECT id FROM wallets WHERE client_id = $1 AND address IN ($2, $3) "+
+		" ORDER BY address FOR UPDATE", id, guidA, guidB)
+
+	return err
+}
+
+func isWalletActive(q querier, id int, guid string) bool {
+	var active bool
+	q.QueryRow("SELECT is_active FROM wallets WHERE client_id = $1 AND address = $2", id, guid).Scan(&active)
 
 	return active
 }
 
-// CreditWalletByIDGUID credit the wallet return newbalance or error
-func (db *DB) CreditWalletByIDGUID(id int, guid string, amt float64) (*float64, *float64, error) {
-	var oldBalance float64
+// creditWallet add amt to the balance in a single statement so concurrent credits are not lost
+func creditWallet(q querier, id int, guid string, amt Amount) (*Amount, *Amount, error) {
+	var newBalance Amount
 
 	uAt := time.Now().Local()
 
-	db.QueryRow("SELECT balance FROM wallets WHERE client_id = $1 AND address = $2", id, guid).Scan(&oldBalance)
-	newBalance := oldBalance + amt
-
-	_, err := db.Exec("UPDATE wallets SET balance = $3, updated_at = $4 WHERE client_id = $1 AND address = $2", id, guid, newBalance, uAt)
+	err := q.QueryRow("UPDATE wallets SET balance = balance + $3, updated_at = $4, "+
+		" overdraft_used = CASE WHEN overdraft_first THEN GREATEST(overdraft_used - $3, 0) ELSE overdraft_used END "+
+		" WHERE client_id = $1 AND address = $2 RETURNING balance", id, guid, amt, uAt).Scan(&newBalance)
 	if err != nil {
 		return nil, nil, err
 	}
+	oldBalance := newBalance - amt
 
 	return &oldBalance, &newBalance, nil
 }
 
-// DebitWalletByIDGUID debit the wallet return newbalance or error
-func (db *DB) DebitWalletByIDGUID(id int, guid string, amt float64) (*float64, *float64, error) {
-	var oldBalance float64
-
-	db.QueryRow("SELECT balance FROM wallets WHERE client_id = $1 AND address = $2", id, guid).Scan(&oldBalance)
+// debitWallet subtract amt from the balance in a single statement so concurrent debits are not lost,
+// the part not covered by the spendable money (balance + overdraft_used) is drawn from the credit line
+func debitWallet(q querier, id int, guid string, amt Amount) (*Amount, *Amount, error) {
+	var newBalance Amount
 
 	uAt := time.Now().Local()
 
-	newBalance := oldBalance - amt
-	_, err := db.Exec("UPDATE wallets SET balance = $3, updated_at = $4 WHERE client_id = $1 AND address = $2", id, guid, newBalance, uAt)
+	err := q.QueryRow("UPDATE wallets SET balance = balance - $3, updated_at = $4, "+
+		" overdraft_used = overdraft_used + GREATEST($3 - (balance + overdraft_used), 0) "+
+		" WHERE client_id = $1 AND address = $2 RETURNING balance", id, guid, amt, uAt).Scan(&newBalance)
 	if err != nil {
 		return nil, nil, err
 	}
+	oldBalance := newBalance + amt
 
 	return &oldBalance, &newBalance, nil
 }
 
-// IsBalanceEnoughForDebit return bool if have enough balance for debit request
-func (db *DB) IsBalanceEnoughForDebit(id int, guid string, amt float64) bool {
-	var oldBalance float64
+// isBalanceEnoughForDebit compare amt with the balance not reserved by holds plus the credit limit
+func isBalanceEnoughForDebit(q querier, id int, guid string, amt Amount) bool {
+	var available Amount
 
-	db.QueryRow("SELECT balance FROM wallets WHERE client_id = $1 AND address = $2", id, guid).Scan(&oldBalance)
-	if amt > oldBalance {
+	q.QueryRow("SELECT balance - held_balance + credit_limit FROM wallets WHERE client_id = $1 AND address = $2",
+		id, guid).Scan(&available)
+	if amt > available {
 		return false
 	}
 
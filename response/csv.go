@@ -0,0 +1,19 @@
+package response
+
+import (
+	"encoding/csv"
+	"net/http"
+)
+
+// CSV response as a file download with optional status code.
+func CSV(w http.ResponseWriter, filename string, records [][]string, code ...int) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+filename+"\"")
+
+	if len(code) > 0 {
+		w.WriteHeader(code[0])
+	}
+
+	cw := csv.NewWriter(w)
+	cw.WriteAll(records)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/avecost/ewallet/handler"
 	"github.com/avecost/ewallet/models"
@@ -14,6 +15,14 @@ import (
 // Server is the Application Class
 type Server struct {
 	db *models.DB
+	// HoldTTL is how long an authorized hold reserves funds
+	HoldTTL time.Duration
+	// QuoteTTL is how long an exchange quote locks its rate
+	QuoteTTL time.Duration
+	// ReconEvery is the interval of the background reconciliation, zero disables it
+	ReconEvery time.Duration
+	// AdminToken guards the registry and reconciliation admin routes, empty refuses them
+	AdminToken string
 }
 
 // NewServer create our server
@@ -23,11 +32,23 @@ func NewServer(conn string) *Server {
 		panic(err)
 	}
 
-	return &Server{db: c}
+	return &Server{db: c, HoldTTL: 15 * time.Minute, QuoteTTL: 30 * time.Second, ReconEvery: time.Hour}
 }
 
 // Run the main loop of the server
 func (s *Server) Run(addr string) {
+	// release expired holds in the background
+	go s.expireHolds(time.Minute)
+	// debit the credits that lapsed in the background
+	go s.expireCredits(time.Minute)
+	// forfeit the bonuses that lapsed before meeting their wagering in the background
+	go s.forfeitBonuses(time.Minute)
+	// post the scheduled transactions that are due in the background
+	go s.runSchedules(time.Minute)
+	// compare the wallet balances with their transactions in the background
+	if s.ReconEvery > 0 {
+		go s.reconcile(s.ReconEvery)
+	}
 	// load the routes
 	s.router(addr)
 	// make sure we close the db session
@@ -40,6 +61,9 @@ func (s *Server) router(port string) {
 
 	// create handler object
 	h := handler.NewHandler(s.db)
+	h.HoldTTL = s.HoldTTL
+	h.QuoteTTL = s.QuoteTTL
+	h.AdminToken = s.AdminToken
 
 	r := mux.NewRouter()
 
@@ -49,16 +73,98 @@ func (s *Server) router(port string) {
 	r.HandleFunc("/v1/clients/{uuid}", h.ClientGetHandler).Methods("GET")
 	r.HandleFunc("/v1/clients/{uuid}", h.ClientPutHandler).Methods("PUT")
 
+	// currency registry routes
+	r.HandleFunc("/v1/currencies", h.CurrencyGetAllHandler).Methods("GET")
+	r.Handle("/v1/currencies", h.WithAdminMiddleware(http.HandlerFunc(h.CurrencyPostHandler))).Methods("POST")
+
+	// exchange rate table routes
+	r.HandleFunc("/v1/fx/rates", h.FXRateGetAllHandler).Methods("GET")
+	r.Handle("/v1/fx/rates", h.WithAdminMiddleware(http.HandlerFunc(h.FXRatePostHandler))).Methods("POST")
+
 	// wallet routes
 	r.Handle("/v1/{uuid}/wallets", h.WithTokenMiddleware(http.HandlerFunc(h.WalletGetAllHandler))).Methods("GET")
 	r.Handle("/v1/{uuid}/wallets", h.WithTokenMiddleware(http.HandlerFunc(h.WalletPostHandler))).Methods("POST")
 	r.Handle("/v1/{uuid}/wallets/{guid}", h.WithTokenMiddleware(http.HandlerFunc(h.WalletGetHandler))).Methods("GET")
 	r.Handle("/v1/{uuid}/wallets/{guid}", h.WithTokenMiddleware(http.HandlerFunc(h.WalletPutHandler))).Methods("PUT")
+	r.Handle("/v1/{uuid}/wallets/{guid}/statement", h.WithTokenMiddleware(http.HandlerFunc(h.WalletStatementGetHandler))).Methods("GET")
+
+	// end-user wallet lookup routes
+	r.Handle("/v1/{uuid}/users/{userID}/wallets", h.WithTokenMiddleware(http.HandlerFunc(h.UserWalletGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/users/{userID}/wallets/{fundType}", h.WithTokenMiddleware(http.HandlerFunc(h.UserWalletGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/users/{userID}/wallets/{fundType}", h.WithTokenMiddleware(http.HandlerFunc(h.UserWalletPutHandler))).Methods("PUT")
 
 	// transaction routes
 	r.Handle("/v1/{uuid}/transaction/{guid}", h.WithTokenMiddleware(http.HandlerFunc(h.GetAllTransactionHandler))).Methods("GET")
 	r.Handle("/v1/{uuid}/transaction/{guid}/credit", h.WithTokenMiddleware(http.HandlerFunc(h.CreditPostHandler))).Methods("POST")
 	r.Handle("/v1/{uuid}/transaction/{guid}/debit", h.WithTokenMiddleware(http.HandlerFunc(h.DebitPostHandler))).Methods("POST")
+	r.Handle("/v1/{uuid}/transaction/{guid}/reversals", h.WithTokenMiddleware(http.HandlerFunc(h.ReversalPostHandler))).Methods("POST")
+	r.Handle("/v1/{uuid}/transactions/{referenceCode}", h.WithTokenMiddleware(http.HandlerFunc(h.TransactionLookupGetHandler))).Methods("GET")
+
+	// transfer routes
+	r.Handle("/v1/{uuid}/transfers", h.WithTokenMiddleware(http.HandlerFunc(h.TransferPostHandler))).Methods("POST")
+
+	// hold routes
+	r.Handle("/v1/{uuid}/wallets/{guid}/holds", h.WithTokenMiddleware(http.HandlerFunc(h.HoldGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/wallets/{guid}/holds", h.WithTokenMiddleware(http.HandlerFunc(h.HoldPostHandler))).Methods("POST")
+	r.Handle("/v1/{uuid}/wallets/{guid}/holds/{code}/capture", h.WithTokenMiddleware(http.HandlerFunc(h.HoldCapturePostHandler))).Methods("POST")
+	r.Handle("/v1/{uuid}/wallets/{guid}/holds/{code}/void", h.WithTokenMiddleware(http.HandlerFunc(h.HoldVoidPostHandler))).Methods("POST")
+
+	// seamless gaming wallet routes
+	r.Handle("/v1/{uuid}/seamless/bet", h.WithTokenMiddleware(http.HandlerFunc(h.SeamlessBetHandler))).Methods("POST")
+	r.Handle("/v1/{uuid}/seamless/win", h.WithTokenMiddleware(http.HandlerFunc(h.SeamlessWinHandler))).Methods("POST")
+	r.Handle("/v1/{uuid}/seamless/rollback", h.WithTokenMiddleware(http.HandlerFunc(h.SeamlessRollbackHandler))).Methods("POST")
+	r.Handle("/v1/{uuid}/seamless/endRound", h.WithTokenMiddleware(http.HandlerFunc(h.SeamlessEndRoundHandler))).Methods("POST")
+	r.Handle("/v1/{uuid}/seamless/rounds/{roundId}", h.WithTokenMiddleware(http.HandlerFunc(h.SeamlessRoundGetHandler))).Methods("GET")
+
+	// currency exchange routes
+	r.Handle("/v1/{uuid}/fx/quotes", h.WithTokenMiddleware(http.HandlerFunc(h.FXQuotePostHandler))).Methods("POST")
+	r.Handle("/v1/{uuid}/fx/exchanges", h.WithTokenMiddleware(http.HandlerFunc(h.FXExchangePostHandler))).Methods("POST")
+
+	// ledger routes
+	r.Handle("/v1/{uuid}/accounts", h.WithTokenMiddleware(http.HandlerFunc(h.AccountGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/wallets/{guid}/ledger", h.WithTokenMiddleware(http.HandlerFunc(h.WalletLedgerGetHandler))).Methods("GET")
+
+	// limit routes
+	r.Handle("/v1/{uuid}/limits", h.WithTokenMiddleware(http.HandlerFunc(h.LimitGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/limits", h.WithTokenMiddleware(http.HandlerFunc(h.LimitPostHandler))).Methods("POST")
+	r.Handle("/v1/{uuid}/wallets/{guid}/headroom", h.WithTokenMiddleware(http.HandlerFunc(h.HeadroomGetHandler))).Methods("GET")
+
+	// overdraft routes
+	r.Handle("/v1/{uuid}/overdrafts", h.WithTokenMiddleware(http.HandlerFunc(h.OverdraftGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/wallets/{guid}/overdraft", h.WithTokenMiddleware(http.HandlerFunc(h.OverdraftPutHandler))).Methods("PUT")
+	r.Handle("/v1/{uuid}/wallets/{guid}/overdraft/repay", h.WithTokenMiddleware(http.HandlerFunc(h.OverdraftRepayPostHandler))).Methods("POST")
+
+	// balance bucket routes
+	r.Handle("/v1/{uuid}/wallets/{guid}/buckets", h.WithTokenMiddleware(http.HandlerFunc(h.WalletBucketsGetHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/wallets/{guid}/buckets/precedence", h.WithTokenMiddleware(http.HandlerFunc(h.BucketPrecedencePutHandler))).Methods("PUT")
+
+	// bonus routes
+	r.Handle("/v1/{uuid}/wallets/{guid}/bonuses", h.WithTokenMiddleware(http.HandlerFunc(h.BonusGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/wallets/{guid}/bonuses", h.WithTokenMiddleware(http.HandlerFunc(h.BonusPostHandler))).Methods("POST")
+
+	// fee routes
+	r.Handle("/v1/{uuid}/fees", h.WithTokenMiddleware(http.HandlerFunc(h.FeeGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/fees", h.WithTokenMiddleware(http.HandlerFunc(h.FeePostHandler))).Methods("POST")
+	r.Handle("/v1/{uuid}/fees/{id}", h.WithTokenMiddleware(http.HandlerFunc(h.FeeDeleteHandler))).Methods("DELETE")
+	r.Handle("/v1/{uuid}/wallets/{guid}/fees/preview", h.WithTokenMiddleware(http.HandlerFunc(h.FeePreviewGetHandler))).Methods("GET")
+
+	// catalog routes
+	r.Handle("/v1/{uuid}/catalog/method-types", h.WithTokenMiddleware(http.HandlerFunc(h.MethodTypeGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/catalog/method-types/{code}", h.WithTokenMiddleware(http.HandlerFunc(h.MethodTypePutHandler))).Methods("PUT")
+	r.Handle("/v1/{uuid}/catalog/method-types/{code}", h.WithTokenMiddleware(http.HandlerFunc(h.MethodTypeDeleteHandler))).Methods("DELETE")
+	r.Handle("/v1/{uuid}/catalog/fund-types", h.WithTokenMiddleware(http.HandlerFunc(h.FundTypeGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/catalog/fund-types/{code}", h.WithTokenMiddleware(http.HandlerFunc(h.FundTypePutHandler))).Methods("PUT")
+	r.Handle("/v1/{uuid}/catalog/fund-types/{code}", h.WithTokenMiddleware(http.HandlerFunc(h.FundTypeDeleteHandler))).Methods("DELETE")
+
+	// schedule routes
+	r.Handle("/v1/{uuid}/wallets/{guid}/schedules", h.WithTokenMiddleware(http.HandlerFunc(h.ScheduleGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/wallets/{guid}/schedules", h.WithTokenMiddleware(http.HandlerFunc(h.SchedulePostHandler))).Methods("POST")
+	r.Handle("/v1/{uuid}/wallets/{guid}/schedules/{id}/runs", h.WithTokenMiddleware(http.HandlerFunc(h.ScheduleRunGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/wallets/{guid}/schedules/{id}/{action}", h.WithTokenMiddleware(http.HandlerFunc(h.ScheduleActionPostHandler))).Methods("POST")
+
+	// reconciliation routes
+	r.Handle("/v1/{uuid}/recon/breaks", h.WithTokenMiddleware(http.HandlerFunc(h.ReconBreakGetAllHandler))).Methods("GET")
+	r.Handle("/v1/{uuid}/recon/breaks/{id}/resolve", h.WithAdminMiddleware(http.HandlerFunc(h.ReconBreakResolvePostHandler))).Methods("POST")
 
 	// inform that we are live
 	fmt.Println("e-Wallet is running on port: ", port)
@@ -69,3 +175,58 @@ func (s *Server) router(port string) {
 		log.Fatal("Server Error: ", err)
 	}
 }
+
+// expireHolds periodically release the holds that passed their TTL
+func (s *Server) expireHolds(every time.Duration) {
+	for range time.Tick(every) {
+		if _, err := s.db.ExpireHolds(); err != nil {
+			log.Println("Expire holds: ", err)
+		}
+	}
+}
+
+// expireCredits periodically post the expiry of the credit lots that lapsed
+func (s *Server) expireCredits(every time.Duration) {
+	for range time.Tick(every) {
+		if _, err := s.db.ExpireCredits(); err != nil {
+			log.Println("Expire credits: ", err)
+		}
+	}
+}
+
+// forfeitBonuses periodically forfeit the bonus grants past their expiry
+func (s *Server) forfeitBonuses(every time.Duration) {
+	for range time.Tick(every) {
+		if _, err := s.db.ForfeitBonuses(); err != nil {
+			log.Println("Forfeit bonuses: ", err)
+		}
+	}
+}
+
+// runSchedules periodically post the due scheduled transactions
+func (s *Server) runSchedules(every time.Duration) {
+	for range time.Tick(every) {
+		if _, err := s.db.RunDueSchedules(); err != nil {
+			log.Println("Run schedules: ", err)
+		}
+	}
+}
+
+// Reconcile run one reconciliation pass over every wallet
+func (s *Server) Reconcile() (*models.ReconRun, error) {
+	return s.db.Reconcile()
+}
+
+// reconcile periodically run the reconciliation
+func (s *Server) reconcile(every time.Duration) {
+	for range time.Tick(every) {
+		run, err := s.db.Reconcile()
+		if err != nil {
+			log.Println("Reconcile: ", err)
+			continue
+		}
+		if run.BreaksFound > 0 {
+			log.Printf("Reconcile: run %d found %d breaks in %d wallets", run.ID, run.BreaksFound, run.WalletsChecked)
+		}
+	}
+}